@@ -1,6 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -10,25 +16,370 @@ import (
 
 // go test -v homework_test.go
 
+const defaultQueueCapacity = 1024
+
+var (
+	ErrPoolFull   = errors.New("worker pool is full")
+	ErrPoolClosed = errors.New("worker pool is closed")
+)
+
+type PoolOption func(*WorkerPool)
+
+// WithQueueCapacity sets how many tasks can wait for a free worker
+func WithQueueCapacity(capacity int) PoolOption {
+	return func(wp *WorkerPool) {
+		if capacity < 0 {
+			panic("negative queue capacity")
+		}
+		wp.capacity = capacity
+	}
+}
+
+// WithOnPanic sets a hook that is called by a worker
+// after it recovers from a panic in a task
+func WithOnPanic(onPanic func(value any, stack []byte)) PoolOption {
+	return func(wp *WorkerPool) {
+		wp.onPanic = onPanic
+	}
+}
+
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+type Stats struct {
+	Active    int
+	Idle      int
+	Retiring  int // removed by Resize but still finishing a task
+	Queued    int
+	Completed uint64
+	Panicked  uint64
+	AvgWait   time.Duration
+	AvgRun    time.Duration
+}
+
+type job struct {
+	task     func()
+	abandon  func() // called if the job is drained from the queue
+	enqueued time.Time
+}
+
 type WorkerPool struct {
-	// need to implement
+	mutex    sync.Mutex
+	closed   bool
+	capacity int
+	tasks    chan job
+	stops    []chan struct{} // one per live worker
+	wg       sync.WaitGroup
+	onPanic  func(any, []byte)
+
+	live      atomic.Int64 // worker goroutines that have not exited yet
+	active    atomic.Int64
+	completed atomic.Uint64
+	panicked  atomic.Uint64
+	waitTime  atomic.Int64
+	runTime   atomic.Int64
+}
+
+func NewWorkerPool(workersNumber int, options ...PoolOption) *WorkerPool {
+	if workersNumber <= 0 {
+		panic("incorrect workers number")
+	}
+
+	wp := &WorkerPool{
+		capacity: defaultQueueCapacity,
+		onPanic: func(value any, stack []byte) {
+			log.Printf("worker pool: task panicked: %v\n%s", value, stack)
+		},
+	}
+	for _, option := range options {
+		option(wp)
+	}
+
+	wp.tasks = make(chan job, wp.capacity)
+	wp.startWorkers(workersNumber)
+	return wp
+}
+
+// startWorkers must be called with the mutex held
+// or before the pool is published
+func (wp *WorkerPool) startWorkers(number int) {
+	wp.wg.Add(number)
+	wp.live.Add(int64(number))
+	for i := 0; i < number; i++ {
+		stop := make(chan struct{})
+		wp.stops = append(wp.stops, stop)
+		go wp.worker(stop)
+	}
 }
 
-func NewWorkerPool(workersNumber int) *WorkerPool {
-	// need to implement
-	return &WorkerPool{}
+func (wp *WorkerPool) worker(stop <-chan struct{}) {
+	defer wp.wg.Done()
+	defer wp.live.Add(-1)
+	for {
+		// a retired worker must not pick up new tasks
+		// even if both channels are ready
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		select {
+		case <-stop:
+			return
+		case job, ok := <-wp.tasks:
+			if !ok {
+				return
+			}
+			wp.run(job)
+		}
+	}
+}
+
+func (wp *WorkerPool) run(job job) {
+	wp.active.Add(1)
+	defer wp.active.Add(-1)
+
+	start := time.Now()
+	wp.waitTime.Add(int64(start.Sub(job.enqueued)))
+	defer func() {
+		wp.runTime.Add(int64(time.Since(start)))
+		if value := recover(); value != nil {
+			wp.panicked.Add(1)
+			if wp.onPanic != nil {
+				wp.onPanic(value, debug.Stack())
+			}
+			return
+		}
+		wp.completed.Add(1)
+	}()
+
+	job.task()
+}
+
+func (wp *WorkerPool) enqueue(task, abandon func()) error {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+
+	if wp.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case wp.tasks <- job{task: task, abandon: abandon, enqueued: time.Now()}:
+		return nil
+	default:
+		return ErrPoolFull
+	}
 }
 
 // Return an error if the pool is full
 func (wp *WorkerPool) AddTask(task func()) error {
-	// need to implement
+	if task == nil {
+		return errors.New("nil task")
+	}
+	return wp.enqueue(task, nil)
+}
+
+// Resize doesn't wait for the excess workers, they exit
+// after their current tasks and queued tasks stay in the queue
+func (wp *WorkerPool) Resize(workersNumber int) error {
+	if workersNumber <= 0 {
+		return errors.New("incorrect workers number")
+	}
+
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+
+	if wp.closed {
+		return ErrPoolClosed
+	}
+
+	current := len(wp.stops)
+	if workersNumber > current {
+		wp.startWorkers(workersNumber - current)
+		return nil
+	}
+
+	for _, stop := range wp.stops[workersNumber:] {
+		close(stop)
+	}
+	wp.stops = wp.stops[:workersNumber]
 	return nil
 }
 
-// Shutdown all workers and wait for all
-// tasks in the pool to complete
-func (wp *WorkerPool) Shutdown() {
-	// need to implement
+func (wp *WorkerPool) Stats() Stats {
+	wp.mutex.Lock()
+	workers := len(wp.stops)
+	wp.mutex.Unlock()
+
+	stats := Stats{
+		Active:    int(wp.active.Load()),
+		Queued:    len(wp.tasks),
+		Completed: wp.completed.Load(),
+		Panicked:  wp.panicked.Load(),
+	}
+
+	live := int(wp.live.Load())
+	stats.Idle = max(live-stats.Active, 0)
+	stats.Retiring = max(live-workers, 0)
+	if executed := stats.Completed + stats.Panicked; executed != 0 {
+		stats.AvgWait = time.Duration(uint64(wp.waitTime.Load()) / executed)
+		stats.AvgRun = time.Duration(uint64(wp.runTime.Load()) / executed)
+	}
+
+	return stats
+}
+
+type ShutdownReport struct {
+	Completed uint64 // finished tasks including panicked ones
+	Abandoned int    // queued tasks that will never be executed
+	Running   int    // tasks that were still executing
+}
+
+func (wp *WorkerPool) close() {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+
+	if !wp.closed {
+		wp.closed = true
+		close(wp.tasks)
+	}
+}
+
+// drain must be called after the pool is closed
+func (wp *WorkerPool) drain() []func() {
+	var tasks []func()
+	for job := range wp.tasks {
+		if job.abandon != nil {
+			job.abandon()
+		}
+		tasks = append(tasks, job.task)
+	}
+	return tasks
+}
+
+func (wp *WorkerPool) report(abandoned int) ShutdownReport {
+	return ShutdownReport{
+		Completed: wp.completed.Load() + wp.panicked.Load(),
+		Abandoned: abandoned,
+		Running:   int(wp.active.Load()),
+	}
+}
+
+// Shutdown stops accepting tasks and waits for all queued tasks
+// to complete, if the context is done before that, the rest
+// of the queue is abandoned and returned with the context error
+func (wp *WorkerPool) Shutdown(ctx context.Context) ([]func(), ShutdownReport, error) {
+	wp.close()
+
+	done := make(chan struct{})
+	go func() {
+		wp.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil, wp.report(0), nil
+	case <-ctx.Done():
+		abandoned := wp.drain()
+		return abandoned, wp.report(len(abandoned)), ctx.Err()
+	}
+}
+
+// ShutdownNow stops accepting tasks and returns queued tasks
+// without waiting for the running ones, futures of abandoned
+// tasks are resolved with ErrPoolClosed
+func (wp *WorkerPool) ShutdownNow() ([]func(), ShutdownReport) {
+	wp.close()
+
+	abandoned := wp.drain()
+	return abandoned, wp.report(len(abandoned))
+}
+
+type Future[T any] struct {
+	once   sync.Once
+	done   chan struct{}
+	result T
+	err    error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// resolve keeps the first result, so an abandoned task
+// that is requeued elsewhere can't resolve the future again
+func (f *Future[T]) resolve(result T, err error) {
+	f.once.Do(func() {
+		f.result = result
+		f.err = err
+		close(f.done)
+	})
+}
+
+// Done is closed when the result of the task is ready
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get waits for the result of the task or for
+// the context cancellation whichever comes first
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Submit doesn't block if the pool is full, the context is passed
+// to the task and the task is skipped if the context is canceled
+// before a worker picks it up
+func Submit[T any](ctx context.Context, wp *WorkerPool, task func(context.Context) (T, error)) (*Future[T], error) {
+	if task == nil {
+		return nil, errors.New("nil task")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	future := newFuture[T]()
+	err := wp.enqueue(func() {
+		defer func() {
+			// the future is resolved with an error and
+			// the pool still gets the panic to report it
+			if value := recover(); value != nil {
+				var zero T
+				future.resolve(zero, &PanicError{Value: value, Stack: debug.Stack()})
+				panic(value)
+			}
+		}()
+
+		if err := ctx.Err(); err != nil {
+			var zero T
+			future.resolve(zero, err)
+			return
+		}
+		future.resolve(task(ctx))
+	}, func() {
+		var zero T
+		future.resolve(zero, ErrPoolClosed)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return future, nil
 }
 
 func TestWorkerPool(t *testing.T) {
@@ -52,7 +403,308 @@ func TestWorkerPool(t *testing.T) {
 	_ = pool.AddTask(task)
 	_ = pool.AddTask(task)
 	_ = pool.AddTask(task)
-	pool.Shutdown() // wait tasks
+	_, _, _ = pool.Shutdown(context.Background()) // wait tasks
+
+	assert.Equal(t, int32(6), counter.Load())
+}
+
+func TestWorkerPoolErrors(t *testing.T) {
+	release := make(chan struct{})
+	task := func() {
+		<-release
+	}
+
+	pool := NewWorkerPool(1, WithQueueCapacity(1))
+	assert.NoError(t, pool.AddTask(task))
+	time.Sleep(time.Millisecond * 100) // worker is busy
+
+	assert.NoError(t, pool.AddTask(task))
+	assert.ErrorIs(t, pool.AddTask(task), ErrPoolFull)
+
+	close(release)
+	_, _, _ = pool.Shutdown(context.Background())
+
+	assert.ErrorIs(t, pool.AddTask(task), ErrPoolClosed)
+	_, err := Submit(context.Background(), pool, func(context.Context) (int, error) {
+		return 0, nil
+	})
+	assert.ErrorIs(t, err, ErrPoolClosed)
+}
+
+func TestWorkerPoolSubmit(t *testing.T) {
+	pool := NewWorkerPool(2)
+	defer pool.Shutdown(context.Background())
+
+	future, err := Submit(context.Background(), pool, func(context.Context) (int, error) {
+		time.Sleep(time.Millisecond * 100)
+		return 42, nil
+	})
+	assert.NoError(t, err)
+
+	select {
+	case <-future.Done():
+		t.Fatal("future is resolved before the task is completed")
+	default:
+	}
+
+	result, err := future.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 42, result)
+
+	expectedErr := errors.New("error")
+	failed, err := Submit(context.Background(), pool, func(context.Context) (string, error) {
+		return "", expectedErr
+	})
+	assert.NoError(t, err)
+
+	_, err = failed.Get(context.Background())
+	assert.ErrorIs(t, err, expectedErr)
+}
+
+func TestWorkerPoolSubmitWithContext(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewWorkerPool(1)
+	defer pool.Shutdown(context.Background())
+
+	_ = pool.AddTask(func() {
+		<-release
+	})
+	time.Sleep(time.Millisecond * 100) // worker is busy
+
+	var executed atomic.Bool
+	ctx, cancel := context.WithCancel(context.Background())
+	future, err := Submit(ctx, pool, func(context.Context) (int, error) {
+		executed.Store(true)
+		return 1, nil
+	})
+	assert.NoError(t, err)
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer timeoutCancel()
+
+	_, err = future.Get(timeoutCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	cancel()
+	close(release)
+
+	_, err = future.Get(context.Background())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, executed.Load())
+
+	_, err = Submit(ctx, pool, func(context.Context) (int, error) {
+		return 1, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWorkerPoolPanic(t *testing.T) {
+	var reported atomic.Value
+	pool := NewWorkerPool(1, WithOnPanic(func(value any, stack []byte) {
+		reported.Store(value)
+		assert.Contains(t, string(stack), "TestWorkerPoolPanic")
+	}))
+	defer pool.Shutdown(context.Background())
+
+	_ = pool.AddTask(func() {
+		panic("task panic")
+	})
+
+	future, err := Submit(context.Background(), pool, func(context.Context) (int, error) {
+		panic("future panic")
+	})
+	assert.NoError(t, err)
+
+	_, err = future.Get(context.Background())
+	var panicErr *PanicError
+	assert.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, "future panic", panicErr.Value)
+
+	// the worker survives panics
+	result, err := Submit(context.Background(), pool, func(context.Context) (int, error) {
+		return 1, nil
+	})
+	assert.NoError(t, err)
+	value, err := result.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+
+	assert.Eventually(t, func() bool {
+		return reported.Load() == "future panic"
+	}, time.Second, time.Millisecond*10)
+
+	stats := pool.Stats()
+	assert.Equal(t, uint64(2), stats.Panicked)
+	assert.Equal(t, uint64(1), stats.Completed)
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	var counter atomic.Int32
+	release := make(chan struct{})
+	task := func() {
+		<-release
+		counter.Add(1)
+	}
+
+	pool := NewWorkerPool(1)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, pool.AddTask(task))
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	stats := pool.Stats()
+	assert.Equal(t, 1, stats.Active)
+	assert.Equal(t, 0, stats.Idle)
+	assert.Equal(t, 5, stats.Queued)
+
+	assert.NoError(t, pool.Resize(4))
+	time.Sleep(time.Millisecond * 100)
+	stats = pool.Stats()
+	assert.Equal(t, 4, stats.Active)
+	assert.Equal(t, 2, stats.Queued)
 
+	assert.NoError(t, pool.Resize(2))
+	time.Sleep(time.Millisecond * 100)
+	stats = pool.Stats()
+	assert.Equal(t, 4, stats.Active)
+	assert.Equal(t, 0, stats.Idle)
+	assert.Equal(t, 2, stats.Retiring)
+
+	close(release)
+	time.Sleep(time.Millisecond * 100)
+
+	stats = pool.Stats()
+	assert.Equal(t, 0, stats.Active)
+	assert.Equal(t, 2, stats.Idle)
+	assert.Equal(t, 0, stats.Retiring)
+	assert.Equal(t, 0, stats.Queued)
+	assert.Equal(t, uint64(6), stats.Completed)
+	assert.Greater(t, stats.AvgWait, time.Duration(0))
+	assert.Greater(t, stats.AvgRun, time.Duration(0))
+
+	assert.Error(t, pool.Resize(0))
+	_, _, _ = pool.Shutdown(context.Background())
 	assert.Equal(t, int32(6), counter.Load())
+	assert.ErrorIs(t, pool.Resize(2), ErrPoolClosed)
+}
+
+func TestWorkerPoolShutdownWithDeadline(t *testing.T) {
+	var counter atomic.Int32
+	task := func() {
+		time.Sleep(time.Millisecond * 300)
+		counter.Add(1)
+	}
+
+	pool := NewWorkerPool(2)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, pool.AddTask(task))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	abandoned, report, err := pool.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, abandoned, 2)
+	assert.Equal(t, ShutdownReport{Completed: 2, Abandoned: 2, Running: 2}, report)
+	assert.ErrorIs(t, pool.AddTask(task), ErrPoolClosed)
+
+	time.Sleep(time.Millisecond * 300)
+	assert.Equal(t, int32(4), counter.Load())
+
+	abandoned, report, err = pool.Shutdown(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, abandoned)
+	assert.Equal(t, ShutdownReport{Completed: 4}, report)
+}
+
+func TestWorkerPoolShutdownNow(t *testing.T) {
+	var counter atomic.Int32
+	release := make(chan struct{})
+	task := func() {
+		<-release
+		counter.Add(1)
+	}
+
+	pool := NewWorkerPool(1)
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, pool.AddTask(task))
+	}
+	time.Sleep(time.Millisecond * 100) // worker is busy
+
+	abandoned, report := pool.ShutdownNow()
+	assert.Len(t, abandoned, 3)
+	assert.Equal(t, ShutdownReport{Abandoned: 3, Running: 1}, report)
+	assert.ErrorIs(t, pool.AddTask(task), ErrPoolClosed)
+
+	close(release)
+	_, report, err := pool.Shutdown(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, ShutdownReport{Completed: 1}, report)
+
+	// abandoned tasks can be requeued into another pool
+	other := NewWorkerPool(2)
+	for _, task := range abandoned {
+		assert.NoError(t, other.AddTask(task))
+	}
+	_, _, _ = other.Shutdown(context.Background())
+	assert.Equal(t, int32(4), counter.Load())
+}
+
+func TestWorkerPoolAbandonedFutures(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewWorkerPool(1)
+	assert.NoError(t, pool.AddTask(func() {
+		<-release
+	}))
+	time.Sleep(time.Millisecond * 100) // worker is busy
+
+	var calls atomic.Int32
+	future, err := Submit(context.Background(), pool, func(context.Context) (int, error) {
+		calls.Add(1)
+		return 42, nil
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	abandoned, report, err := pool.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, abandoned, 1)
+	assert.Equal(t, 1, report.Abandoned)
+
+	getCtx, getCancel := context.WithTimeout(context.Background(), time.Second)
+	defer getCancel()
+	result, err := future.Get(getCtx)
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	assert.Equal(t, 0, result)
+
+	// the requeued task runs, but the future keeps the first result
+	abandoned[0]()
+	assert.Equal(t, int32(1), calls.Load())
+	_, err = future.Get(context.Background())
+	assert.ErrorIs(t, err, ErrPoolClosed)
+
+	close(release)
+	_, _, _ = pool.Shutdown(context.Background())
+
+	// the same for futures abandoned by ShutdownNow
+	pool = NewWorkerPool(1)
+	release = make(chan struct{})
+	assert.NoError(t, pool.AddTask(func() {
+		<-release
+	}))
+	time.Sleep(time.Millisecond * 100)
+
+	future, err = Submit(context.Background(), pool, func(context.Context) (int, error) {
+		return 42, nil
+	})
+	assert.NoError(t, err)
+
+	abandoned, _ = pool.ShutdownNow()
+	assert.Len(t, abandoned, 1)
+	_, err = future.Get(getCtx)
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	close(release)
 }
@@ -3,6 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -10,22 +14,188 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("goroutine panicked: %v", e.Value)
+}
+
+// TaskError tags an error with the index of the goroutine
+// in the order of starting and with its name if any
+type TaskError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *TaskError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("task %q: %v", e.Name, e.Err)
+	}
+	return fmt.Sprintf("task #%d: %v", e.Index, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+type GroupOption func(*Group)
+
+// WithCollectAll makes the group wait for all goroutines without
+// canceling the context on failure, Wait returns all errors
+// joined and every error is wrapped into TaskError
+func WithCollectAll() GroupOption {
+	return func(g *Group) {
+		g.collectAll = true
+	}
+}
+
 type Group struct {
-	// need to implement
+	cancel  context.CancelCauseFunc
+	wg      sync.WaitGroup
+	sem     chan struct{}
+	started atomic.Int64
+
+	errOnce sync.Once
+	err     error
+
+	collectAll bool
+	mutex      sync.Mutex
+	errs       []*TaskError
+}
+
+// NewErrGroup returns a group and a derived context that is canceled
+// with the first error as the cause or when Wait returns
+func NewErrGroup(ctx context.Context, options ...GroupOption) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	group := &Group{cancel: cancel}
+	for _, option := range options {
+		option(group)
+	}
+	return group, ctx
 }
 
-func NewErrGroup(ctx context.Context) (*Group, context.Context) {
-	// need to implement
-	return &Group{}, ctx
+// SetLimit limits the number of active goroutines, a negative
+// value means no limit, the limit can't be changed while
+// any goroutines in the group are active
+func (g *Group) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("errgroup: modify limit while %v goroutines in the group are still active", len(g.sem)))
+	}
+	g.sem = make(chan struct{}, n)
 }
 
+// Go blocks until the new goroutine can be added without
+// the number of active goroutines exceeding the limit
 func (g *Group) Go(action func() error) {
-	// need to implement
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start("", action)
+}
+
+// GoNamed is the same as Go, but the name is used
+// to tag the error in the collect-all mode
+func (g *Group) GoNamed(name string, action func() error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start(name, action)
+}
+
+// TryGo starts the action only if the limit isn't reached
+func (g *Group) TryGo(action func() error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start("", action)
+	return true
+}
+
+func (g *Group) start(name string, action func() error) {
+	index := int(g.started.Add(1) - 1)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+
+		err := call(action)
+		if err == nil {
+			return
+		}
+
+		if g.collectAll {
+			g.mutex.Lock()
+			g.errs = append(g.errs, &TaskError{Index: index, Name: name, Err: err})
+			g.mutex.Unlock()
+		} else {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel(err)
+				}
+			})
+		}
+	}()
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
+
+func (g *Group) joinErrors() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(g.errs) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(g.errs, func(lhs, rhs *TaskError) int {
+		return lhs.Index - rhs.Index
+	})
+
+	errs := make([]error, 0, len(g.errs))
+	for _, err := range g.errs {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
+func call(action func() error) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+	return action()
+}
+
+// Wait blocks until all goroutines are completed and returns
+// the first error if any or all errors in the collect-all mode
 func (g *Group) Wait() error {
-	// need to implement
-	return nil
+	g.wg.Wait()
+	if g.collectAll {
+		g.err = g.joinErrors()
+	}
+	if g.cancel != nil {
+		g.cancel(g.err)
+	}
+	return g.err
 }
 
 func TestErrGroupWithoutError(t *testing.T) {
@@ -72,3 +242,149 @@ func TestErrGroupWithError(t *testing.T) {
 	assert.Equal(t, int32(0), counter.Load())
 	assert.Error(t, err)
 }
+
+type CustomError struct {
+	Code int
+}
+
+func (e *CustomError) Error() string {
+	return fmt.Sprintf("custom error %d", e.Code)
+}
+
+func TestErrGroupCollectAll(t *testing.T) {
+	var counter atomic.Int32
+	errFirst := errors.New("first error")
+	group, ctx := NewErrGroup(context.Background(), WithCollectAll())
+
+	group.Go(func() error {
+		return errFirst
+	})
+
+	for i := 0; i < 3; i++ {
+		group.Go(func() error {
+			timer := time.NewTimer(time.Millisecond * 100)
+			defer timer.Stop()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+				counter.Add(1)
+				return nil
+			}
+		})
+	}
+
+	group.GoNamed("custom", func() error {
+		return &CustomError{Code: 42}
+	})
+
+	err := group.Wait()
+	assert.Equal(t, int32(3), counter.Load())
+	assert.ErrorIs(t, err, errFirst)
+
+	var customErr *CustomError
+	assert.ErrorAs(t, err, &customErr)
+	assert.Equal(t, 42, customErr.Code)
+
+	var taskErr *TaskError
+	assert.ErrorAs(t, err, &taskErr)
+	assert.Equal(t, 0, taskErr.Index)
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	assert.True(t, ok)
+
+	errs := joined.Unwrap()
+	assert.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "task #0: first error")
+	assert.EqualError(t, errs[1], `task "custom": custom error 42`)
+	assert.ErrorIs(t, context.Cause(ctx), errFirst)
+}
+
+func TestErrGroupCancelCause(t *testing.T) {
+	expectedErr := errors.New("error")
+	group, ctx := NewErrGroup(context.Background())
+
+	group.Go(func() error {
+		return expectedErr
+	})
+	group.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := group.Wait()
+	assert.ErrorIs(t, err, expectedErr)
+	assert.ErrorIs(t, context.Cause(ctx), expectedErr)
+
+	group, ctx = NewErrGroup(context.Background())
+	group.Go(func() error {
+		return nil
+	})
+
+	assert.NoError(t, group.Wait())
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestErrGroupWithLimit(t *testing.T) {
+	var active, maxActive atomic.Int32
+	group, _ := NewErrGroup(context.Background())
+	group.SetLimit(2)
+
+	for i := 0; i < 6; i++ {
+		group.Go(func() error {
+			current := active.Add(1)
+			defer active.Add(-1)
+
+			for {
+				previous := maxActive.Load()
+				if current <= previous || maxActive.CompareAndSwap(previous, current) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond * 100)
+			return nil
+		})
+	}
+
+	assert.NoError(t, group.Wait())
+	assert.Equal(t, int32(2), maxActive.Load())
+}
+
+func TestErrGroupTryGo(t *testing.T) {
+	release := make(chan struct{})
+	group, _ := NewErrGroup(context.Background())
+	group.SetLimit(1)
+
+	assert.True(t, group.TryGo(func() error {
+		<-release
+		return nil
+	}))
+	assert.False(t, group.TryGo(func() error {
+		return nil
+	}))
+
+	close(release)
+	assert.NoError(t, group.Wait())
+
+	assert.True(t, group.TryGo(func() error {
+		return nil
+	}))
+	assert.NoError(t, group.Wait())
+}
+
+func TestErrGroupWithPanic(t *testing.T) {
+	group, ctx := NewErrGroup(context.Background())
+	group.Go(func() error {
+		panic("panic")
+	})
+
+	err := group.Wait()
+	var panicErr *PanicError
+	assert.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, "panic", panicErr.Value)
+	assert.Equal(t, "goroutine panicked: panic", panicErr.Error())
+	assert.NotEmpty(t, panicErr.Stack)
+	assert.ErrorIs(t, context.Cause(ctx), err)
+}
@@ -1,7 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,18 +16,158 @@ import (
 
 // go test -v homework_test.go
 
+type ErrorFormatFunc func([]error) string
+
+// ListFormatFunc is the default format of MultiError
+func ListFormatFunc(errs []error) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d errors occured:\n", len(errs))
+	for _, err := range errs {
+		builder.WriteString("\t* ")
+		builder.WriteString(err.Error())
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
+
 type MultiError struct {
-	// need to implement
+	Errors      []error
+	ErrorFormat ErrorFormatFunc
 }
 
 func (e *MultiError) Error() string {
-	// need to implement
-	return ""
+	format := e.ErrorFormat
+	if format == nil {
+		format = ListFormatFunc
+	}
+	return format(e.Errors)
+}
+
+// Unwrap is used by errors.Is and errors.As to inspect every error
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// ErrorOrNil returns nil if there are no errors, it should be used
+// to return *MultiError as error to avoid a non-nil interface
+func (e *MultiError) ErrorOrNil() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
 }
 
+// Append adds errors to err, if err is *MultiError the result
+// keeps its format, nested *MultiError values are flattened
 func Append(err error, errs ...error) *MultiError {
-	// need to implement
-	return nil
+	result := &MultiError{}
+	switch err := err.(type) {
+	case *MultiError:
+		if err != nil {
+			result.ErrorFormat = err.ErrorFormat
+			result.Errors = flatten(result.Errors, err.Errors...)
+		}
+	case nil:
+	default:
+		result.Errors = append(result.Errors, err)
+	}
+
+	result.Errors = flatten(result.Errors, errs...)
+	return result
+}
+
+func flatten(dst []error, errs ...error) []error {
+	for _, err := range errs {
+		switch err := err.(type) {
+		case *MultiError:
+			if err != nil {
+				dst = flatten(dst, err.Errors...)
+			}
+		case nil:
+		default:
+			dst = append(dst, err)
+		}
+	}
+	return dst
+}
+
+type errorJSON struct {
+	Message string   `json:"message"`
+	Type    string   `json:"type"`
+	Wrapped []string `json:"wrapped,omitempty"`
+}
+
+type multiErrorJSON struct {
+	Count  int         `json:"count"`
+	Errors []errorJSON `json:"errors"`
+}
+
+// MarshalJSON writes every error with its message, its type
+// and types of the errors it wraps from the outermost one
+func (e *MultiError) MarshalJSON() ([]byte, error) {
+	result := multiErrorJSON{
+		Count:  len(e.Errors),
+		Errors: make([]errorJSON, 0, len(e.Errors)),
+	}
+
+	for _, err := range e.Errors {
+		entry := errorJSON{
+			Message: err.Error(),
+			Type:    fmt.Sprintf("%T", err),
+		}
+		for wrapped := errors.Unwrap(err); wrapped != nil; wrapped = errors.Unwrap(wrapped) {
+			entry.Wrapped = append(entry.Wrapped, fmt.Sprintf("%T", wrapped))
+		}
+		result.Errors = append(result.Errors, entry)
+	}
+
+	return json.Marshal(result)
+}
+
+// Collector is safe to use from multiple goroutines
+type Collector struct {
+	mutex  sync.Mutex
+	errors []error
+}
+
+func (c *Collector) Add(errs ...error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.errors = flatten(c.errors, errs...)
+}
+
+// Err returns a snapshot of collected errors or nil
+func (c *Collector) Err() *MultiError {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.errors) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: slices.Clone(c.errors)}
+}
+
+type Group struct {
+	wg        sync.WaitGroup
+	collector Collector
+}
+
+func (g *Group) Go(action func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := action(); err != nil {
+			g.collector.Add(err)
+		}
+	}()
+}
+
+// Wait blocks until all goroutines are completed
+// and returns their errors or nil
+func (g *Group) Wait() *MultiError {
+	g.wg.Wait()
+	return g.collector.Err()
 }
 
 func TestMultiError(t *testing.T) {
@@ -31,3 +178,141 @@ func TestMultiError(t *testing.T) {
 	expectedMessage := "2 errors occured:\n\t* error 1\t* error 2\n"
 	assert.EqualError(t, err, expectedMessage)
 }
+
+var (
+	ErrNumber1 = errors.New("error 1")
+	ErrNumber2 = errors.New("error 2")
+	ErrNumber3 = errors.New("error 3")
+)
+
+func TestMultiErrorWrapping(t *testing.T) {
+	var err error
+	err = Append(err, ErrNumber1)
+	err = Append(err, &fs.PathError{Op: "open", Path: "file", Err: fs.ErrNotExist})
+	err = Append(err, ErrNumber2)
+	err = fmt.Errorf("internal error: %w", err)
+
+	assert.ErrorIs(t, err, ErrNumber1)
+	assert.ErrorIs(t, err, ErrNumber2)
+	assert.NotErrorIs(t, err, ErrNumber3)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	var pathErr *fs.PathError
+	assert.ErrorAs(t, err, &pathErr)
+	assert.Equal(t, "file", pathErr.Path)
+
+	var multiErr *MultiError
+	assert.ErrorAs(t, err, &multiErr)
+	assert.Len(t, multiErr.Errors, 3)
+}
+
+func TestMultiErrorFlattening(t *testing.T) {
+	nested := Append(ErrNumber1, ErrNumber2)
+	err := Append(nil, nested, nil, Append(nested, ErrNumber3))
+
+	assert.Equal(t, []error{ErrNumber1, ErrNumber2, ErrNumber1, ErrNumber2, ErrNumber3}, err.Errors)
+	assert.Equal(t, []error{ErrNumber1, ErrNumber2}, nested.Errors)
+}
+
+func TestMultiErrorFormat(t *testing.T) {
+	err := &MultiError{
+		ErrorFormat: func(errs []error) string {
+			messages := make([]string, 0, len(errs))
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			return strings.Join(messages, "; ")
+		},
+	}
+
+	err = Append(err, ErrNumber1, ErrNumber2)
+	assert.EqualError(t, err, "error 1; error 2")
+}
+
+func TestMultiErrorOrNil(t *testing.T) {
+	var multiErr *MultiError
+	assert.Nil(t, multiErr.ErrorOrNil())
+	assert.Nil(t, Append(nil).ErrorOrNil())
+	assert.Nil(t, Append(nil, nil, nil).ErrorOrNil())
+
+	err := Append(nil, ErrNumber1).ErrorOrNil()
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrNumber1)
+}
+
+func TestMultiErrorJSON(t *testing.T) {
+	err := Append(nil,
+		ErrNumber1,
+		fmt.Errorf("read config: %w", &fs.PathError{Op: "open", Path: "file", Err: fs.ErrNotExist}),
+	)
+
+	data, marshalErr := json.Marshal(err)
+	assert.NoError(t, marshalErr)
+	assert.JSONEq(t, `{
+		"count": 2,
+		"errors": [
+			{"message": "error 1", "type": "*errors.errorString"},
+			{
+				"message": "read config: open file: file does not exist",
+				"type": "*fmt.wrapError",
+				"wrapped": ["*fs.PathError", "*errors.errorString"]
+			}
+		]
+	}`, string(data))
+}
+
+func TestMultiErrorCollector(t *testing.T) {
+	const goroutinesNumber = 100
+
+	var collector Collector
+	assert.Nil(t, collector.Err())
+
+	var wg sync.WaitGroup
+	wg.Add(goroutinesNumber)
+	for i := 0; i < goroutinesNumber; i++ {
+		go func() {
+			defer wg.Done()
+			collector.Add(fmt.Errorf("error %d", i), nil)
+		}()
+	}
+
+	wg.Wait()
+	assert.Len(t, collector.Err().Errors, goroutinesNumber)
+
+	snapshot := collector.Err()
+	collector.Add(Append(ErrNumber1, ErrNumber2))
+	assert.Len(t, snapshot.Errors, goroutinesNumber)
+	assert.Len(t, collector.Err().Errors, goroutinesNumber+2)
+}
+
+func BenchmarkCollectorAdd(b *testing.B) {
+	err := errors.New("error")
+	for i := 0; i < b.N; i++ {
+		var collector Collector
+		for j := 0; j < 1000; j++ {
+			collector.Add(err)
+		}
+	}
+}
+
+func TestMultiErrorGroup(t *testing.T) {
+	var group Group
+	for i := 0; i < 10; i++ {
+		group.Go(func() error {
+			if i%2 == 0 {
+				return ErrNumber1
+			}
+			return nil
+		})
+	}
+
+	err := group.Wait()
+	assert.Len(t, err.Errors, 5)
+	assert.ErrorIs(t, err, ErrNumber1)
+
+	var empty Group
+	empty.Go(func() error {
+		return nil
+	})
+	assert.Nil(t, empty.Wait())
+}
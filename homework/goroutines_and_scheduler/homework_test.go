@@ -1,36 +1,592 @@
 package main
 
 import (
+	"cmp"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/bits"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// Task is dispatched before its Deadline by the EDF policy,
+// the zero deadline means no deadline, Tenant groups tasks
+// for the fair-share policy
 type Task struct {
 	Identifier int
 	Priority   int
+	Deadline   time.Time
+	Tenant     string
 }
 
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskExists   = errors.New("task already exists")
+)
+
+// Entry is a waiting task as seen by the policy, the task is kept
+// as it was added and the current priority is stored separately,
+// Tag is a policy-specific ordering key
+type Entry struct {
+	Task     Task
+	Priority int
+	Enqueued time.Time
+	Tag      int64
+}
+
+// Policy orders waiting tasks, tasks that are equal for the
+// policy are dispatched in the insertion order, methods are
+// called with the scheduler lock held
+type Policy interface {
+	Added(entry *Entry)
+	PriorityChanged(entry *Entry)
+	Taken(entry *Entry)
+	Removed(entry *Entry)
+	Less(lhs, rhs *Entry) bool
+}
+
+// PriorityPolicy dispatches tasks with the highest priority first,
+// with the aging interval the effective priority of a task is
+// raised by the aging step for every interval of waiting,
+// the aging step must not be negative
+type PriorityPolicy struct {
+	AgingInterval time.Duration
+	AgingStep     int
+
+	epoch time.Time
+}
+
+func (p *PriorityPolicy) Added(entry *Entry) {
+	if p.epoch.IsZero() {
+		p.epoch = entry.Enqueued
+	}
+	p.PriorityChanged(entry)
+}
+
+// agingFractionBits is the precision of the effective priority,
+// priorities up to 2^47 by the absolute value are ordered exactly
+const agingFractionBits = 16
+
+// PriorityChanged keeps the time the task has already waited, all tasks
+// age at the same rate, so the order of waiting tasks doesn't change
+// with time, the tag is the effective priority in the fixed point and
+// saturates instead of overflowing, so huge values can only tie
+func (p *PriorityPolicy) PriorityChanged(entry *Entry) {
+	if p.AgingInterval <= 0 {
+		entry.Tag = int64(entry.Priority)
+		return
+	}
+	entry.Tag = saturatingSub(
+		saturatingMul(int64(entry.Priority), 1<<agingFractionBits),
+		p.aging(entry.Enqueued.Sub(p.epoch)),
+	)
+}
+
+// aging returns step * waited / interval in the fixed point,
+// the product is computed in 128 bits to avoid the overflow
+func (p *PriorityPolicy) aging(waited time.Duration) int64 {
+	if waited < 0 {
+		return -p.aging(-waited)
+	}
+
+	high, low := bits.Mul64(uint64(waited), uint64(p.AgingStep))
+	if high>>(64-agingFractionBits) != 0 {
+		return math.MaxInt64
+	}
+	high, low = high<<agingFractionBits|low>>(64-agingFractionBits), low<<agingFractionBits
+
+	if high >= uint64(p.AgingInterval) {
+		return math.MaxInt64
+	}
+	quotient, _ := bits.Div64(high, low, uint64(p.AgingInterval))
+	return int64(min(quotient, math.MaxInt64))
+}
+
+func saturatingMul(lhs, rhs int64) int64 {
+	if lhs == 0 || rhs == 0 {
+		return 0
+	}
+
+	product := lhs * rhs
+	if product/rhs != lhs || (lhs == -1 && rhs == math.MinInt64) || (rhs == -1 && lhs == math.MinInt64) {
+		if (lhs < 0) == (rhs < 0) {
+			return math.MaxInt64
+		}
+		return math.MinInt64
+	}
+	return product
+}
+
+func saturatingSub(lhs, rhs int64) int64 {
+	difference := lhs - rhs
+	switch {
+	case lhs >= 0 && rhs < 0 && difference < 0:
+		return math.MaxInt64
+	case lhs < 0 && rhs > 0 && difference >= 0:
+		return math.MinInt64
+	default:
+		return difference
+	}
+}
+
+func (p *PriorityPolicy) Taken(*Entry)   {}
+func (p *PriorityPolicy) Removed(*Entry) {}
+
+func (p *PriorityPolicy) Less(lhs, rhs *Entry) bool {
+	return lhs.Tag > rhs.Tag
+}
+
+// DeadlinePolicy dispatches the task with the earliest deadline first,
+// tasks without deadlines wait for all tasks with deadlines and are
+// ordered by priority
+type DeadlinePolicy struct{}
+
+func (DeadlinePolicy) Added(*Entry)           {}
+func (DeadlinePolicy) PriorityChanged(*Entry) {}
+func (DeadlinePolicy) Taken(*Entry)           {}
+func (DeadlinePolicy) Removed(*Entry)         {}
+
+func (DeadlinePolicy) Less(lhs, rhs *Entry) bool {
+	lhsDeadline, rhsDeadline := lhs.Task.Deadline, rhs.Task.Deadline
+	switch {
+	case lhsDeadline.IsZero() && rhsDeadline.IsZero():
+		return lhs.Priority > rhs.Priority
+	case lhsDeadline.IsZero() || rhsDeadline.IsZero():
+		return rhsDeadline.IsZero()
+	default:
+		return lhsDeadline.Before(rhsDeadline)
+	}
+}
+
+const fairShareCost = 1 << 20
+
+// FairSharePolicy is weighted fair queuing across tenants, every task
+// gets a virtual finish time when it's added and tenants are served
+// in proportion to their weights, the default weight is 1
+type FairSharePolicy struct {
+	weights     map[string]int
+	virtualTime int64
+	finishes    map[string]int64
+}
+
+func NewFairSharePolicy(weights map[string]int) *FairSharePolicy {
+	return &FairSharePolicy{
+		weights:  weights,
+		finishes: make(map[string]int64),
+	}
+}
+
+func (p *FairSharePolicy) cost(tenant string) int64 {
+	weight := p.weights[tenant]
+	if weight <= 0 {
+		weight = 1
+	}
+	return fairShareCost / int64(weight)
+}
+
+func (p *FairSharePolicy) Added(entry *Entry) {
+	start := max(p.virtualTime, p.finishes[entry.Task.Tenant])
+	entry.Tag = start + p.cost(entry.Task.Tenant)
+	p.finishes[entry.Task.Tenant] = entry.Tag
+}
+
+func (p *FairSharePolicy) PriorityChanged(*Entry) {}
+
+func (p *FairSharePolicy) Taken(entry *Entry) {
+	p.virtualTime = max(p.virtualTime, entry.Tag)
+}
+
+// Removed gives the cost of the task that never ran back to the tenant,
+// tags of other waiting tasks aren't changed, so the credit goes to the
+// next task of the tenant
+func (p *FairSharePolicy) Removed(entry *Entry) {
+	tenant := entry.Task.Tenant
+	p.finishes[tenant] = max(p.finishes[tenant]-p.cost(tenant), p.virtualTime)
+}
+
+func (p *FairSharePolicy) Less(lhs, rhs *Entry) bool {
+	return lhs.Tag < rhs.Tag
+}
+
+type item struct {
+	Entry
+	sequence uint64 // insertion order for equal tasks
+	index    int
+}
+
+// taskHeap is a heap ordered by the policy, every item knows its
+// position, so an item can be fixed or removed in O(log n)
+type taskHeap struct {
+	items  []*item
+	policy Policy
+}
+
+func (h *taskHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *taskHeap) Less(i, j int) bool {
+	lhs, rhs := h.items[i], h.items[j]
+	if h.policy.Less(&lhs.Entry, &rhs.Entry) {
+		return true
+	}
+	if h.policy.Less(&rhs.Entry, &lhs.Entry) {
+		return false
+	}
+	return lhs.sequence < rhs.sequence
+}
+
+func (h *taskHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *taskHeap) Push(value any) {
+	item := value.(*item)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *taskHeap) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items[len(h.items)-1] = nil
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
+
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+type SchedulerOption func(*Scheduler)
+
+// WithPolicy replaces the default priority policy, a policy
+// keeps state, so it can't be shared between schedulers
+func WithPolicy(policy Policy) SchedulerOption {
+	return func(s *Scheduler) {
+		s.heap.policy = policy
+	}
+}
+
+// WithAging uses the priority policy with aging,
+// so low priority tasks can't starve
+func WithAging(interval time.Duration, step int) SchedulerOption {
+	if interval <= 0 || step < 0 {
+		panic("incorrect aging configuration")
+	}
+	return WithPolicy(&PriorityPolicy{AgingInterval: interval, AgingStep: step})
+}
+
+func WithClock(clock Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// Scheduler returns tasks in the order of the policy, the priority
+// policy without aging is used by default, it's safe for concurrent
+// use and the zero value is an empty scheduler
 type Scheduler struct {
-	// need to implement
+	clock Clock
+
+	mutex    sync.Mutex
+	heap     taskHeap
+	items    map[int]*item
+	sequence uint64
+	wakeup   chan struct{} // closed when a task is added
 }
 
-func NewScheduler() Scheduler {
-	// need to implement
-	return Scheduler{}
+func NewScheduler(options ...SchedulerOption) *Scheduler {
+	scheduler := &Scheduler{}
+	for _, option := range options {
+		option(scheduler)
+	}
+	scheduler.init()
+	return scheduler
 }
 
-func (s *Scheduler) AddTask(task Task) {
-	// need to implement
+func (s *Scheduler) init() {
+	if s.items == nil {
+		s.items = make(map[int]*item)
+	}
+	if s.clock == nil {
+		s.clock = realClock{}
+	}
+	if s.heap.policy == nil {
+		s.heap.policy = &PriorityPolicy{}
+	}
 }
 
-func (s *Scheduler) ChangeTaskPriority(taskID int, newPriority int) {
-	// need to implement
+func (s *Scheduler) AddTask(task Task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.items[task.Identifier]; found {
+		return fmt.Errorf("%w: %d", ErrTaskExists, task.Identifier)
+	}
+	s.init()
+
+	item := &item{
+		Entry:    Entry{Task: task, Priority: task.Priority, Enqueued: s.clock.Now()},
+		sequence: s.sequence,
+	}
+	s.heap.policy.Added(&item.Entry)
+	s.sequence++
+	s.items[task.Identifier] = item
+	heap.Push(&s.heap, item)
+
+	if s.wakeup != nil {
+		close(s.wakeup)
+		s.wakeup = nil
+	}
+	return nil
+}
+
+func (s *Scheduler) ChangeTaskPriority(taskID int, newPriority int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, found := s.items[taskID]
+	if !found {
+		return fmt.Errorf("%w: %d", ErrTaskNotFound, taskID)
+	}
+
+	item.Priority = newPriority
+	s.heap.policy.PriorityChanged(&item.Entry)
+	heap.Fix(&s.heap, item.index)
+	return nil
 }
 
+// GetTask removes and returns the first task
+// or the zero task if the scheduler is empty
 func (s *Scheduler) GetTask() Task {
-	// need to implement
-	return Task{}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	task, _ := s.pop()
+	return task
+}
+
+// GetTaskContext blocks until a task is available
+// or returns the context error if the context is done
+func (s *Scheduler) GetTaskContext(ctx context.Context) (Task, error) {
+	for {
+		s.mutex.Lock()
+		if task, found := s.pop(); found {
+			s.mutex.Unlock()
+			return task, nil
+		}
+		if s.wakeup == nil {
+			s.wakeup = make(chan struct{})
+		}
+		wakeup := s.wakeup
+		s.mutex.Unlock()
+
+		select {
+		case <-wakeup:
+		case <-ctx.Done():
+			return Task{}, ctx.Err()
+		}
+	}
+}
+
+func (s *Scheduler) pop() (Task, bool) {
+	if s.heap.Len() == 0 {
+		return Task{}, false
+	}
+
+	item := heap.Pop(&s.heap).(*item)
+	delete(s.items, item.Task.Identifier)
+	s.heap.policy.Taken(&item.Entry)
+	return item.Task, true
+}
+
+func (s *Scheduler) Peek() (Task, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.heap.Len() == 0 {
+		return Task{}, false
+	}
+	return s.heap.items[0].Task, true
+}
+
+func (s *Scheduler) Remove(taskID int) (Task, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, found := s.items[taskID]
+	if !found {
+		return Task{}, fmt.Errorf("%w: %d", ErrTaskNotFound, taskID)
+	}
+
+	heap.Remove(&s.heap, item.index)
+	delete(s.items, taskID)
+	s.heap.policy.Removed(&item.Entry)
+	return item.Task, nil
+}
+
+func (s *Scheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.heap.Len()
+}
+
+// fakeClock is moved by hand, so simulations
+// and tests don't depend on the real time
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+func (c *fakeClock) Advance(duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(duration)
+}
+
+// TraceEntry is a task that arrives at the offset from the start of
+// the simulation and runs for the duration, the deadline is relative
+// to the arrival and the zero deadline means no deadline
+type TraceEntry struct {
+	Arrival  time.Duration
+	Duration time.Duration
+	Deadline time.Duration
+	Task     Task
+}
+
+type TenantReport struct {
+	Tasks          int
+	P50            time.Duration
+	P90            time.Duration
+	P99            time.Duration
+	Max            time.Duration
+	DeadlineMisses int
+}
+
+type SimulationReport map[string]TenantReport
+
+func (r SimulationReport) String() string {
+	var builder strings.Builder
+	for _, tenant := range slices.Sorted(maps.Keys(r)) {
+		report := r[tenant]
+		fmt.Fprintf(&builder, "%q: tasks=%d p50=%v p90=%v p99=%v max=%v deadline misses=%d\n",
+			tenant, report.Tasks, report.P50, report.P90, report.P99, report.Max, report.DeadlineMisses)
+	}
+	return builder.String()
+}
+
+// percentile uses the nearest-rank method on sorted values
+func percentile(sorted []time.Duration, percent int) time.Duration {
+	rank := (len(sorted)*percent + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
+
+var simulationStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Simulate replays the trace on a scheduler with the policy and
+// a single worker, the latency of a task is the time from its
+// arrival to its completion
+func Simulate(policy Policy, trace []TraceEntry) (SimulationReport, error) {
+	entries := slices.Clone(trace)
+	slices.SortStableFunc(entries, func(lhs, rhs TraceEntry) int {
+		return cmp.Compare(lhs.Arrival, rhs.Arrival)
+	})
+
+	clock := &fakeClock{now: simulationStart}
+	scheduler := NewScheduler(WithClock(clock), WithPolicy(policy))
+	arrived := make(map[int]TraceEntry, len(entries))
+
+	var next int
+	addArrivals := func(until time.Duration) error {
+		for ; next < len(entries) && entries[next].Arrival <= until; next++ {
+			entry := entries[next]
+			clock.Set(simulationStart.Add(entry.Arrival))
+			if entry.Deadline > 0 {
+				entry.Task.Deadline = simulationStart.Add(entry.Arrival + entry.Deadline)
+			}
+			if err := scheduler.AddTask(entry.Task); err != nil {
+				return err
+			}
+			arrived[entry.Task.Identifier] = entry
+		}
+		return nil
+	}
+
+	latencies := make(map[string][]time.Duration)
+	report := make(SimulationReport)
+
+	var elapsed time.Duration
+	for {
+		if err := addArrivals(elapsed); err != nil {
+			return nil, err
+		}
+		if scheduler.Len() == 0 {
+			if next == len(entries) {
+				break
+			}
+			elapsed = entries[next].Arrival
+			continue
+		}
+
+		entry := arrived[scheduler.GetTask().Identifier]
+		completion := elapsed + entry.Duration
+		if err := addArrivals(completion); err != nil {
+			return nil, err
+		}
+		elapsed = completion
+		clock.Set(simulationStart.Add(elapsed))
+
+		tenant := entry.Task.Tenant
+		latencies[tenant] = append(latencies[tenant], completion-entry.Arrival)
+		if entry.Deadline > 0 && completion > entry.Arrival+entry.Deadline {
+			tenantReport := report[tenant]
+			tenantReport.DeadlineMisses++
+			report[tenant] = tenantReport
+		}
+	}
+
+	for tenant, values := range latencies {
+		slices.Sort(values)
+		tenantReport := report[tenant]
+		tenantReport.Tasks = len(values)
+		tenantReport.P50 = percentile(values, 50)
+		tenantReport.P90 = percentile(values, 90)
+		tenantReport.P99 = percentile(values, 99)
+		tenantReport.Max = values[len(values)-1]
+		report[tenant] = tenantReport
+	}
+	return report, nil
 }
 
 func TestTrace(t *testing.T) {
@@ -61,3 +617,440 @@ func TestTrace(t *testing.T) {
 	task = scheduler.GetTask()
 	assert.Equal(t, task3, task)
 }
+
+func TestSchedulerEqualPriorities(t *testing.T) {
+	scheduler := NewScheduler()
+	for id := 1; id <= 5; id++ {
+		assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Priority: id % 2}))
+	}
+
+	assert.NoError(t, scheduler.ChangeTaskPriority(2, 1))
+
+	var order []int
+	for scheduler.Len() != 0 {
+		order = append(order, scheduler.GetTask().Identifier)
+	}
+	assert.Equal(t, []int{1, 2, 3, 5, 4}, order)
+}
+
+func TestSchedulerOperations(t *testing.T) {
+	var scheduler Scheduler
+	_, found := scheduler.Peek()
+	assert.False(t, found)
+	assert.Equal(t, Task{}, scheduler.GetTask())
+
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 1, Priority: 10}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 2, Priority: 20}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 3, Priority: 30}))
+	assert.ErrorIs(t, scheduler.AddTask(Task{Identifier: 3, Priority: 0}), ErrTaskExists)
+	assert.Equal(t, 3, scheduler.Len())
+
+	task, found := scheduler.Peek()
+	assert.True(t, found)
+	assert.Equal(t, Task{Identifier: 3, Priority: 30}, task)
+	assert.Equal(t, 3, scheduler.Len())
+
+	task, err := scheduler.Remove(3)
+	assert.NoError(t, err)
+	assert.Equal(t, Task{Identifier: 3, Priority: 30}, task)
+	_, err = scheduler.Remove(3)
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+	assert.ErrorIs(t, scheduler.ChangeTaskPriority(3, 100), ErrTaskNotFound)
+
+	assert.NoError(t, scheduler.ChangeTaskPriority(1, 100))
+	assert.Equal(t, Task{Identifier: 1, Priority: 10}, scheduler.GetTask())
+	assert.Equal(t, Task{Identifier: 2, Priority: 20}, scheduler.GetTask())
+	assert.Equal(t, 0, scheduler.Len())
+
+	// the identifier can be reused after the task is taken
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 1, Priority: 1}))
+}
+
+func TestSchedulerRandomOperations(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	scheduler := NewScheduler()
+
+	// the reference keeps tasks in the insertion order
+	var reference []Task
+	priorities := make(map[int]int)
+	best := func() int {
+		index := 0
+		for i, task := range reference {
+			if priorities[task.Identifier] > priorities[reference[index].Identifier] {
+				index = i
+			}
+		}
+		return index
+	}
+
+	for id := 0; id < 10_000; id++ {
+		switch operation := random.Intn(4); {
+		case operation == 0 || len(reference) == 0:
+			task := Task{Identifier: id, Priority: random.Intn(100)}
+			assert.NoError(t, scheduler.AddTask(task))
+			reference = append(reference, task)
+			priorities[task.Identifier] = task.Priority
+		case operation == 1:
+			id := reference[random.Intn(len(reference))].Identifier
+			priorities[id] = random.Intn(100)
+			assert.NoError(t, scheduler.ChangeTaskPriority(id, priorities[id]))
+		case operation == 2:
+			index := random.Intn(len(reference))
+			task, err := scheduler.Remove(reference[index].Identifier)
+			assert.NoError(t, err)
+			assert.Equal(t, reference[index], task)
+			reference = slices.Delete(reference, index, index+1)
+		default:
+			index := best()
+			assert.Equal(t, reference[index], scheduler.GetTask())
+			reference = slices.Delete(reference, index, index+1)
+		}
+		assert.Equal(t, len(reference), scheduler.Len())
+	}
+}
+
+func TestSchedulerAging(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	scheduler := NewScheduler(WithClock(clock), WithAging(time.Second, 1))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 0, Priority: 0}))
+
+	// a stream of high priority tasks doesn't starve the low priority one
+	var order []int
+	for id := 1; id <= 20; id++ {
+		clock.Advance(time.Second)
+		assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Priority: 10}))
+		order = append(order, scheduler.GetTask().Identifier)
+	}
+
+	// after 10 seconds the waiting task catches up with a new one
+	// and wins the tie as the earlier added one
+	assert.Equal(t, 9, slices.Index(order, 0))
+	assert.Equal(t, 1, scheduler.Len())
+}
+
+func TestSchedulerWithoutAging(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	scheduler := NewScheduler(WithClock(clock))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 0, Priority: 0}))
+
+	for id := 1; id <= 20; id++ {
+		clock.Advance(time.Second)
+		assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Priority: 10}))
+		assert.Equal(t, id, scheduler.GetTask().Identifier)
+	}
+}
+
+func TestSchedulerAgingWithChangedPriority(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	scheduler := NewScheduler(WithClock(clock), WithAging(time.Second, 2))
+
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 1, Priority: 0}))
+	clock.Advance(time.Second * 5)
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 2, Priority: 5}))
+
+	// the first task has gained 10 for waiting
+	assert.Equal(t, 1, scheduler.GetTask().Identifier)
+
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 3, Priority: 5}))
+	clock.Advance(time.Second)
+	assert.NoError(t, scheduler.ChangeTaskPriority(2, 1))
+	assert.Equal(t, 3, scheduler.GetTask().Identifier)
+}
+
+func TestSchedulerAgingWithoutOverflow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	scheduler := NewScheduler(WithClock(clock), WithAging(time.Hour, 1))
+
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 1, Priority: 10_000_000}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 2, Priority: 30_000_000}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 3, Priority: -30_000_000}))
+	clock.Advance(time.Hour * 2)
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 4, Priority: 20_000_000}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 5, Priority: math.MaxInt}))
+
+	var order []int
+	for scheduler.Len() != 0 {
+		order = append(order, scheduler.GetTask().Identifier)
+	}
+	assert.Equal(t, []int{5, 2, 4, 1, 3}, order)
+
+	assert.Panics(t, func() {
+		WithAging(0, 1)
+	})
+	assert.Panics(t, func() {
+		WithAging(time.Second, -1)
+	})
+}
+
+func TestSaturatingArithmetic(t *testing.T) {
+	assert.Equal(t, int64(6), saturatingMul(2, 3))
+	assert.Equal(t, int64(-6), saturatingMul(-2, 3))
+	assert.Equal(t, int64(math.MaxInt64), saturatingMul(math.MaxInt64/2, 3))
+	assert.Equal(t, int64(math.MinInt64), saturatingMul(math.MaxInt64/2, -3))
+	assert.Equal(t, int64(math.MaxInt64), saturatingMul(-1, math.MinInt64))
+	assert.Equal(t, int64(math.MaxInt64), saturatingMul(math.MinInt64, -1))
+
+	assert.Equal(t, int64(-1), saturatingSub(2, 3))
+	assert.Equal(t, int64(math.MaxInt64), saturatingSub(math.MaxInt64, -1))
+	assert.Equal(t, int64(math.MinInt64), saturatingSub(math.MinInt64, 1))
+
+	policy := PriorityPolicy{AgingInterval: time.Hour, AgingStep: 3}
+	assert.Equal(t, int64(3<<agingFractionBits), policy.aging(time.Hour))
+	assert.Equal(t, int64(-3<<agingFractionBits)/2, policy.aging(-time.Minute*30))
+	assert.Equal(t, int64(3*24*365*100)<<agingFractionBits, policy.aging(time.Hour*24*365*100))
+
+	policy = PriorityPolicy{AgingInterval: time.Nanosecond, AgingStep: math.MaxInt}
+	assert.Equal(t, int64(math.MaxInt64), policy.aging(time.Hour))
+}
+
+func TestSchedulerGetTaskContext(t *testing.T) {
+	scheduler := NewScheduler()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	_, err := scheduler.GetTaskContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	result := make(chan Task)
+	go func() {
+		task, err := scheduler.GetTaskContext(context.Background())
+		assert.NoError(t, err)
+		result <- task
+	}()
+
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 1, Priority: 1}))
+	assert.Equal(t, Task{Identifier: 1, Priority: 1}, <-result)
+}
+
+func TestSchedulerConcurrentDispatch(t *testing.T) {
+	const producersNumber = 8
+	const consumersNumber = 4
+	const tasksNumber = 1000
+
+	scheduler := NewScheduler(WithAging(time.Millisecond, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var received atomic.Int32
+	seen := make([]atomic.Bool, producersNumber*tasksNumber)
+
+	var consumers sync.WaitGroup
+	consumers.Add(consumersNumber)
+	for i := 0; i < consumersNumber; i++ {
+		go func() {
+			defer consumers.Done()
+			for {
+				task, err := scheduler.GetTaskContext(ctx)
+				if err != nil {
+					return
+				}
+				assert.False(t, seen[task.Identifier].Swap(true))
+				if received.Add(1) == producersNumber*tasksNumber {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	var producers sync.WaitGroup
+	producers.Add(producersNumber)
+	for producer := 0; producer < producersNumber; producer++ {
+		go func() {
+			defer producers.Done()
+			for i := 0; i < tasksNumber; i++ {
+				id := producer*tasksNumber + i
+				assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Priority: id % 7}))
+			}
+		}()
+	}
+
+	producers.Wait()
+	consumers.Wait()
+	assert.Equal(t, int32(producersNumber*tasksNumber), received.Load())
+	assert.Equal(t, 0, scheduler.Len())
+}
+
+func TestDeadlinePolicy(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduler := NewScheduler(WithPolicy(DeadlinePolicy{}))
+
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 1, Priority: 100}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 2, Priority: 1, Deadline: now.Add(time.Minute)}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 3, Priority: 200}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 4, Priority: 1, Deadline: now.Add(time.Second)}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 5, Priority: 2, Deadline: now.Add(time.Second)}))
+	assert.NoError(t, scheduler.ChangeTaskPriority(1, 300))
+
+	var order []int
+	for scheduler.Len() != 0 {
+		order = append(order, scheduler.GetTask().Identifier)
+	}
+	assert.Equal(t, []int{4, 5, 2, 1, 3}, order)
+}
+
+func TestFairSharePolicy(t *testing.T) {
+	scheduler := NewScheduler(WithPolicy(NewFairSharePolicy(map[string]int{"heavy": 2})))
+
+	for id := 0; id < 6; id++ {
+		assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Priority: 100, Tenant: "heavy"}))
+	}
+	for id := 6; id < 9; id++ {
+		assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Priority: 1, Tenant: "light"}))
+	}
+
+	var order []string
+	for scheduler.Len() != 0 {
+		order = append(order, scheduler.GetTask().Tenant)
+	}
+	assert.Equal(t, []string{"heavy", "heavy", "light", "heavy", "heavy", "light", "heavy", "heavy", "light"}, order)
+
+	// an idle tenant doesn't save credit for later
+	for id := 0; id < 4; id++ {
+		assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Tenant: "heavy"}))
+	}
+	scheduler.GetTask()
+	scheduler.GetTask()
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 4, Tenant: "light"}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 5, Tenant: "light"}))
+
+	order = order[:0]
+	for scheduler.Len() != 0 {
+		order = append(order, scheduler.GetTask().Tenant)
+	}
+	assert.Equal(t, []string{"heavy", "heavy", "light", "light"}, order)
+}
+
+func TestFairSharePolicyRemove(t *testing.T) {
+	scheduler := NewScheduler(WithPolicy(NewFairSharePolicy(nil)))
+	for id := 0; id < 4; id++ {
+		assert.NoError(t, scheduler.AddTask(Task{Identifier: id, Tenant: "heavy"}))
+	}
+
+	// removed tasks never run, so the tenant isn't charged for them
+	for id := 1; id < 4; id++ {
+		_, err := scheduler.Remove(id)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 4, Tenant: "light"}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 5, Tenant: "heavy"}))
+	assert.NoError(t, scheduler.AddTask(Task{Identifier: 6, Tenant: "light"}))
+
+	var order []int
+	for scheduler.Len() != 0 {
+		order = append(order, scheduler.GetTask().Identifier)
+	}
+	assert.Equal(t, []int{0, 4, 5, 6}, order)
+}
+
+func TestSimulateFairShare(t *testing.T) {
+	var trace []TraceEntry
+	for id := 0; id < 100; id++ {
+		trace = append(trace, TraceEntry{
+			Duration: time.Millisecond * 10,
+			Task:     Task{Identifier: id, Priority: 10, Tenant: "batch"},
+		})
+	}
+	for id := 100; id < 110; id++ {
+		trace = append(trace, TraceEntry{
+			Arrival:  time.Duration(id-99) * time.Millisecond * 50,
+			Duration: time.Millisecond,
+			Task:     Task{Identifier: id, Priority: 1, Tenant: "interactive"},
+		})
+	}
+
+	priority, err := Simulate(&PriorityPolicy{}, trace)
+	assert.NoError(t, err)
+	fairShare, err := Simulate(NewFairSharePolicy(nil), trace)
+	assert.NoError(t, err)
+	t.Logf("priority:\n%vfair share:\n%v", priority, fairShare)
+
+	assert.Equal(t, 100, priority["batch"].Tasks)
+	assert.Equal(t, 10, priority["interactive"].Tasks)
+	assert.Equal(t, time.Millisecond*1000, priority["batch"].Max)
+	assert.Greater(t, priority["interactive"].P50, time.Millisecond*500)
+
+	assert.Equal(t, 10, fairShare["interactive"].Tasks)
+	// an interactive task waits for the batch task in service
+	// and at most one more batch task with the same finish time
+	assert.LessOrEqual(t, fairShare["interactive"].Max, time.Millisecond*21)
+	assert.Equal(t, time.Millisecond*1010, fairShare["batch"].Max)
+}
+
+func TestSimulateDeadlines(t *testing.T) {
+	var trace []TraceEntry
+	for id := 0; id < 20; id++ {
+		trace = append(trace, TraceEntry{
+			Duration: time.Millisecond * 10,
+			Deadline: time.Duration(id+1) * time.Millisecond * 10,
+			Task:     Task{Identifier: id, Priority: id, Tenant: "tenant"},
+		})
+	}
+	trace = append(trace, TraceEntry{
+		Arrival:  time.Millisecond * 5,
+		Duration: time.Millisecond,
+		Task:     Task{Identifier: 20, Priority: 100, Tenant: "best effort"},
+	})
+
+	priority, err := Simulate(&PriorityPolicy{}, trace)
+	assert.NoError(t, err)
+	deadline, err := Simulate(DeadlinePolicy{}, trace)
+	assert.NoError(t, err)
+	aging, err := Simulate(&PriorityPolicy{AgingInterval: time.Millisecond, AgingStep: 1}, trace)
+	assert.NoError(t, err)
+	t.Logf("priority:\n%vdeadline:\n%vaging:\n%v", priority, deadline, aging)
+
+	// all tasks with deadlines arrive together and age equally,
+	// so aging can't save them from the priority order
+	assert.Equal(t, priority, aging)
+
+	assert.Equal(t, 10, priority["tenant"].DeadlineMisses)
+	assert.Equal(t, 0, deadline["tenant"].DeadlineMisses)
+	assert.Equal(t, 0, deadline["best effort"].DeadlineMisses)
+	assert.Equal(t, time.Millisecond*196, deadline["best effort"].Max)
+	assert.Equal(t, time.Millisecond*6, priority["best effort"].Max)
+
+	_, err = Simulate(DeadlinePolicy{}, append(trace, trace[0]))
+	assert.ErrorIs(t, err, ErrTaskExists)
+}
+
+const benchmarkTasksNumber = 1_000_000
+
+func newBenchmarkScheduler(random *rand.Rand) *Scheduler {
+	scheduler := NewScheduler()
+	for id := 0; id < benchmarkTasksNumber; id++ {
+		_ = scheduler.AddTask(Task{Identifier: id, Priority: random.Intn(benchmarkTasksNumber)})
+	}
+	return scheduler
+}
+
+func BenchmarkSchedulerAddTask(b *testing.B) {
+	random := rand.New(rand.NewSource(42))
+	for i := 0; i < b.N; i++ {
+		newBenchmarkScheduler(random)
+	}
+}
+
+func BenchmarkSchedulerGetTask(b *testing.B) {
+	random := rand.New(rand.NewSource(42))
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		scheduler := newBenchmarkScheduler(random)
+		b.StartTimer()
+
+		for scheduler.Len() != 0 {
+			scheduler.GetTask()
+		}
+	}
+}
+
+func BenchmarkSchedulerChangeTaskPriority(b *testing.B) {
+	random := rand.New(rand.NewSource(42))
+	scheduler := newBenchmarkScheduler(random)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = scheduler.ChangeTaskPriority(random.Intn(benchmarkTasksNumber), random.Intn(benchmarkTasksNumber))
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 
@@ -21,11 +23,15 @@ type MessageService struct {
 }
 
 type Container struct {
-	deps map[string]callable
+	deps  map[string]callable
+	typed map[dependencyKey]any // func() T for the key type
 }
 
 func NewContainer() *Container {
-	return &Container{deps: make(map[string]callable)}
+	return &Container{
+		deps:  make(map[string]callable),
+		typed: make(map[dependencyKey]any),
+	}
 }
 
 func (c *Container) RegisterType(name string, constructor any) {
@@ -62,6 +68,81 @@ func (c *Container) Resolve(name string) (any, error) {
 	return constructor(), nil
 }
 
+var ErrNotRegistered = errors.New("dependency has not been registered")
+
+// dependencyKey identifies a typed dependency, the name
+// distinguishes multiple implementations of the same type
+type dependencyKey struct {
+	typ  reflect.Type
+	name string
+}
+
+func (k dependencyKey) String() string {
+	if k.name != "" {
+		return fmt.Sprintf("%v named %q", k.typ, k.name)
+	}
+	return k.typ.String()
+}
+
+type DependencyOption func(*dependencyKey)
+
+func Named(name string) DependencyOption {
+	return func(key *dependencyKey) {
+		key.name = name
+	}
+}
+
+func keyFor[T any](options []DependencyOption) dependencyKey {
+	key := dependencyKey{typ: reflect.TypeFor[T]()}
+	for _, option := range options {
+		option(&key)
+	}
+	return key
+}
+
+// Register binds the type to the constructor that is called on
+// every resolution, an interface type can be bound to any of its
+// implementations, a repeated registration replaces the previous one
+func Register[T any](c *Container, constructor func() T, options ...DependencyOption) {
+	c.typed[keyFor[T](options)] = constructor
+}
+
+// RegisterSingleton is the same as Register, but the constructor
+// is called only once on the first resolution
+func RegisterSingleton[T any](c *Container, constructor func() T, options ...DependencyOption) {
+	var (
+		instance T
+		once     sync.Once
+	)
+
+	c.typed[keyFor[T](options)] = func() T {
+		once.Do(func() {
+			instance = constructor()
+		})
+		return instance
+	}
+}
+
+func Resolve[T any](c *Container, options ...DependencyOption) (T, error) {
+	key := keyFor[T](options)
+	constructor, ok := c.typed[key]
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w: %v", ErrNotRegistered, key)
+	}
+	// the key type guarantees the constructor type, so a nil
+	// interface returned by the constructor can't break it
+	return constructor.(func() T)(), nil
+}
+
+func MustResolve[T any](c *Container, options ...DependencyOption) T {
+	dependency, err := Resolve[T](c, options...)
+	if err != nil {
+		panic(err)
+	}
+	return dependency
+}
+
 func TestDIContainer(t *testing.T) {
 	container := NewContainer()
 	container.RegisterType("UserService", func() any {
@@ -103,3 +184,130 @@ func TestDIContainer(t *testing.T) {
 	assert.NotNil(t, oms2)
 
 }
+
+type Notifier interface {
+	Notify(message string) string
+}
+
+type EmailNotifier struct{}
+
+func (EmailNotifier) Notify(message string) string {
+	return "email: " + message
+}
+
+type SMSNotifier struct{}
+
+func (SMSNotifier) Notify(message string) string {
+	return "sms: " + message
+}
+
+func TestTypedDIContainer(t *testing.T) {
+	container := NewContainer()
+	Register(container, func() *UserService {
+		return &UserService{}
+	})
+	RegisterSingleton(container, func() *MessageService {
+		return &MessageService{}
+	})
+
+	userService1, err := Resolve[*UserService](container)
+	assert.NoError(t, err)
+	userService2, err := Resolve[*UserService](container)
+	assert.NoError(t, err)
+	assert.NotNil(t, userService1)
+	assert.False(t, userService1 == userService2)
+
+	messageService1 := MustResolve[*MessageService](container)
+	messageService2 := MustResolve[*MessageService](container)
+	assert.NotNil(t, messageService1)
+	assert.True(t, messageService1 == messageService2)
+
+	// a value type is a different dependency than a pointer
+	userService, err := Resolve[UserService](container)
+	assert.ErrorIs(t, err, ErrNotRegistered)
+	assert.Equal(t, UserService{}, userService)
+
+	assert.Panics(t, func() {
+		MustResolve[*UserService](container, Named("admin"))
+	})
+
+	// the string API is independent of the typed one
+	_, err = container.Resolve("UserService")
+	assert.Error(t, err)
+}
+
+func TestTypedDIContainerWithInterfaces(t *testing.T) {
+	container := NewContainer()
+	Register[Notifier](container, func() Notifier {
+		return EmailNotifier{}
+	})
+	Register[Notifier](container, func() Notifier {
+		return SMSNotifier{}
+	}, Named("sms"))
+
+	notifier, err := Resolve[Notifier](container)
+	assert.NoError(t, err)
+	assert.Equal(t, "email: hello", notifier.Notify("hello"))
+
+	notifier, err = Resolve[Notifier](container, Named("sms"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sms: hello", notifier.Notify("hello"))
+
+	_, err = Resolve[Notifier](container, Named("push"))
+	assert.ErrorIs(t, err, ErrNotRegistered)
+	assert.ErrorContains(t, err, `main.Notifier named "push"`)
+
+	_, err = Resolve[EmailNotifier](container)
+	assert.ErrorIs(t, err, ErrNotRegistered)
+}
+
+func TestTypedDIContainerWithNilInterface(t *testing.T) {
+	container := NewContainer()
+	Register[Notifier](container, func() Notifier {
+		return nil
+	})
+	RegisterSingleton[Notifier](container, func() Notifier {
+		return nil
+	}, Named("singleton"))
+	Register[error](container, func() error {
+		return nil
+	})
+
+	notifier, err := Resolve[Notifier](container)
+	assert.NoError(t, err)
+	assert.Nil(t, notifier)
+
+	notifier, err = Resolve[Notifier](container, Named("singleton"))
+	assert.NoError(t, err)
+	assert.Nil(t, notifier)
+
+	assert.NotPanics(t, func() {
+		assert.Nil(t, MustResolve[error](container))
+	})
+}
+
+func TestTypedDIContainerSingletonConcurrently(t *testing.T) {
+	container := NewContainer()
+
+	var calls int
+	RegisterSingleton(container, func() *MessageService {
+		calls++
+		return &MessageService{}
+	})
+
+	var wg sync.WaitGroup
+	services := make([]*MessageService, 10)
+	for i := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			services[i] = MustResolve[*MessageService](container)
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, calls)
+	for _, service := range services {
+		assert.True(t, service == services[0])
+	}
+}
@@ -1,68 +1,212 @@
 package main
 
 import (
+	"cmp"
+	"fmt"
+	"iter"
+	"math"
+	"math/rand"
 	"reflect"
+	"slices"
 	"testing"
+	"testing/quick"
 
 	"github.com/stretchr/testify/assert"
 )
 
 // go test -v homework_test.go
 
-type node struct {
-	key   int
-	value int
-	left  *node
-	right *node
+// owner marks nodes that can be mutated in place by the map,
+// it isn't empty because pointers to zero-size values may be equal
+type owner struct {
+	_ byte
 }
 
-type OrderedMap struct {
-	root *node
-	len  int
+type node[K, V any] struct {
+	key    K
+	value  V
+	height int
+	size   int // number of nodes in the subtree
+	left   *node[K, V]
+	right  *node[K, V]
+	owner  *owner
 }
 
-func NewOrderedMap() OrderedMap {
-	return OrderedMap{}
+// tree contains read-only operations shared by
+// the map and its snapshots
+type tree[K, V any] struct {
+	root    *node[K, V]
+	len     int
+	compare func(K, K) int
 }
 
-func (m *OrderedMap) insertNode(root *node, key int, value int) *node {
+// OrderedMap is an AVL tree, so the height of the tree
+// is always O(log n) regardless of the insertion order.
+// It copies a node before the mutation if the node
+// is shared with a snapshot, so only the path from the root
+// to the changed node is copied after Snapshot.
+// The zero value is an empty map that panics on Insert,
+// use NewOrderedMap or NewOrderedMapFunc to create a map
+type OrderedMap[K, V any] struct {
+	tree[K, V]
+	owner *owner
+}
+
+// Snapshot is a read-only view of the map at some moment
+type Snapshot[K, V any] struct {
+	tree[K, V]
+}
+
+func NewOrderedMap[K cmp.Ordered, V any]() OrderedMap[K, V] {
+	return NewOrderedMapFunc[K, V](cmp.Compare[K])
+}
+
+// NewOrderedMapFunc orders keys with the compare function that
+// returns a negative number when a < b, a positive number
+// when a > b and zero when a == b
+func NewOrderedMapFunc[K, V any](compare func(a, b K) int) OrderedMap[K, V] {
+	if compare == nil {
+		panic("nil compare function")
+	}
+	return OrderedMap[K, V]{
+		tree:  tree[K, V]{compare: compare},
+		owner: &owner{},
+	}
+}
+
+// Snapshot takes O(1), the map and the snapshot share
+// all nodes until the map is changed
+func (m *OrderedMap[K, V]) Snapshot() Snapshot[K, V] {
+	snapshot := Snapshot[K, V]{tree: m.tree}
+	m.owner = &owner{}
+	return snapshot
+}
+
+func (m *OrderedMap[K, V]) mutable(root *node[K, V]) *node[K, V] {
+	if root.owner == m.owner {
+		return root
+	}
+	copied := *root
+	copied.owner = m.owner
+	return &copied
+}
+
+func height[K, V any](root *node[K, V]) int {
+	if root == nil {
+		return 0
+	}
+	return root.height
+}
+
+func size[K, V any](root *node[K, V]) int {
+	if root == nil {
+		return 0
+	}
+	return root.size
+}
+
+func (n *node[K, V]) update() {
+	n.height = 1 + max(height(n.left), height(n.right))
+	n.size = 1 + size(n.left) + size(n.right)
+}
+
+func (n *node[K, V]) balanceFactor() int {
+	return height(n.left) - height(n.right)
+}
+
+// rotations and balance expect a mutable root
+func (m *OrderedMap[K, V]) rotateRight(root *node[K, V]) *node[K, V] {
+	pivot := m.mutable(root.left)
+	root.left = pivot.right
+	pivot.right = root
+	root.update()
+	pivot.update()
+	return pivot
+}
+
+func (m *OrderedMap[K, V]) rotateLeft(root *node[K, V]) *node[K, V] {
+	pivot := m.mutable(root.right)
+	root.right = pivot.left
+	pivot.left = root
+	root.update()
+	pivot.update()
+	return pivot
+}
+
+func (m *OrderedMap[K, V]) balance(root *node[K, V]) *node[K, V] {
+	root.update()
+
+	switch factor := root.balanceFactor(); {
+	case factor > 1:
+		if root.left.balanceFactor() < 0 {
+			root.left = m.rotateLeft(m.mutable(root.left))
+		}
+		return m.rotateRight(root)
+	case factor < -1:
+		if root.right.balanceFactor() > 0 {
+			root.right = m.rotateRight(m.mutable(root.right))
+		}
+		return m.rotateLeft(root)
+	}
+
+	return root
+}
+
+func (m *OrderedMap[K, V]) insertNode(root *node[K, V], key K, value V) *node[K, V] {
 	if root == nil {
 		m.len++
-		return &node{key: key, value: value}
+		return &node[K, V]{key: key, value: value, height: 1, size: 1, owner: m.owner}
 	}
-	if key < root.key {
+
+	root = m.mutable(root)
+	switch order := m.compare(key, root.key); {
+	case order < 0:
 		root.left = m.insertNode(root.left, key, value)
-	} else if key > root.key {
+	case order > 0:
 		root.right = m.insertNode(root.right, key, value)
-	} else {
+	default:
 		root.value = value
+		return root
 	}
-	return root
+	return m.balance(root)
 }
 
-func (m *OrderedMap) contains(root *node, key int) bool {
-	if root == nil {
-		return false
-	}
-	if key == root.key {
-		return true
+func (m *tree[K, V]) find(key K) *node[K, V] {
+	root := m.root
+	for root != nil {
+		switch order := m.compare(key, root.key); {
+		case order < 0:
+			root = root.left
+		case order > 0:
+			root = root.right
+		default:
+			return root
+		}
 	}
-	if key < root.key {
-		return m.contains(root.left, key)
+	return nil
+}
+
+func (m *OrderedMap[K, V]) removeMin(root *node[K, V]) *node[K, V] {
+	if root.left == nil {
+		return root.right
 	}
-	return m.contains(root.right, key)
+	root = m.mutable(root)
+	root.left = m.removeMin(root.left)
+	return m.balance(root)
 }
 
-func (m *OrderedMap) removeNode(root *node, key int) *node {
+func (m *OrderedMap[K, V]) removeNode(root *node[K, V], key K) *node[K, V] {
 	if root == nil {
 		return nil
 	}
 
-	if key < root.key {
+	root = m.mutable(root)
+	switch order := m.compare(key, root.key); {
+	case order < 0:
 		root.left = m.removeNode(root.left, key)
-	} else if key > root.key {
+	case order > 0:
 		root.right = m.removeNode(root.right, key)
-	} else {
+	default:
 		m.len--
 
 		if root.left == nil {
@@ -80,14 +224,13 @@ func (m *OrderedMap) removeNode(root *node, key int) *node {
 		root.key = successor.key
 		root.value = successor.value
 
-		root.right = m.removeNode(root.right, successor.key)
-
+		root.right = m.removeMin(root.right)
 	}
 
-	return root
+	return m.balance(root)
 }
 
-func (m *OrderedMap) forEach(root *node, action func(int, int)) {
+func (m *tree[K, V]) forEach(root *node[K, V], action func(K, V)) {
 	if root == nil {
 		return
 	}
@@ -96,30 +239,257 @@ func (m *OrderedMap) forEach(root *node, action func(int, int)) {
 	m.forEach(root.right, action)
 }
 
-func (m *OrderedMap) Insert(key, value int) {
+// ascend and descend stop the traversal as soon as yield returns false
+func ascend[K, V any](root *node[K, V], yield func(K, V) bool) bool {
+	if root == nil {
+		return true
+	}
+	return ascend(root.left, yield) && yield(root.key, root.value) && ascend(root.right, yield)
+}
+
+func descend[K, V any](root *node[K, V], yield func(K, V) bool) bool {
+	if root == nil {
+		return true
+	}
+	return descend(root.right, yield) && yield(root.key, root.value) && descend(root.left, yield)
+}
+
+func (m *tree[K, V]) ascendRange(root *node[K, V], from, to K, yield func(K, V) bool) bool {
+	if root == nil {
+		return true
+	}
+
+	afterFrom := m.compare(root.key, from) >= 0
+	beforeTo := m.compare(root.key, to) < 0
+	if afterFrom && !m.ascendRange(root.left, from, to, yield) {
+		return false
+	}
+	if afterFrom && beforeTo && !yield(root.key, root.value) {
+		return false
+	}
+	return !beforeTo || m.ascendRange(root.right, from, to, yield)
+}
+
+// below returns the greatest node with a key less than the key
+// or equal to it if inclusive is set
+func (m *tree[K, V]) below(key K, inclusive bool) *node[K, V] {
+	var result *node[K, V]
+	for root := m.root; root != nil; {
+		order := m.compare(root.key, key)
+		if order < 0 || (inclusive && order == 0) {
+			result = root
+			root = root.right
+		} else {
+			root = root.left
+		}
+	}
+	return result
+}
+
+// above returns the least node with a key greater than the key
+// or equal to it if inclusive is set
+func (m *tree[K, V]) above(key K, inclusive bool) *node[K, V] {
+	var result *node[K, V]
+	for root := m.root; root != nil; {
+		order := m.compare(root.key, key)
+		if order > 0 || (inclusive && order == 0) {
+			result = root
+			root = root.left
+		} else {
+			root = root.right
+		}
+	}
+	return result
+}
+
+func entry[K, V any](found *node[K, V]) (K, V, bool) {
+	if found == nil {
+		var key K
+		var value V
+		return key, value, false
+	}
+	return found.key, found.value, true
+}
+
+// checkInvariants verifies the order of keys, the stored heights,
+// the AVL balance, subtree sizes and the size of the map
+func (m *tree[K, V]) checkInvariants() error {
+	count := 0
+	var check func(root *node[K, V], lower, upper *K) (int, error)
+	check = func(root *node[K, V], lower, upper *K) (int, error) {
+		if root == nil {
+			return 0, nil
+		}
+
+		count++
+		if (lower != nil && m.compare(root.key, *lower) <= 0) || (upper != nil && m.compare(root.key, *upper) >= 0) {
+			return 0, fmt.Errorf("key %v violates the order", root.key)
+		}
+
+		leftHeight, err := check(root.left, lower, &root.key)
+		if err != nil {
+			return 0, err
+		}
+		rightHeight, err := check(root.right, &root.key, upper)
+		if err != nil {
+			return 0, err
+		}
+
+		if root.height != 1+max(leftHeight, rightHeight) {
+			return 0, fmt.Errorf("node %v has incorrect height %d", root.key, root.height)
+		}
+		if factor := leftHeight - rightHeight; factor < -1 || factor > 1 {
+			return 0, fmt.Errorf("node %v is unbalanced with factor %d", root.key, factor)
+		}
+		if root.size != 1+size(root.left)+size(root.right) {
+			return 0, fmt.Errorf("node %v has incorrect size %d", root.key, root.size)
+		}
+
+		return root.height, nil
+	}
+
+	if _, err := check(m.root, nil, nil); err != nil {
+		return err
+	}
+	if count != m.len {
+		return fmt.Errorf("size %d doesn't match %d nodes", m.len, count)
+	}
+	return nil
+}
+
+func (m *OrderedMap[K, V]) Insert(key K, value V) {
+	if m.compare == nil {
+		panic("OrderedMap must be created with NewOrderedMap or NewOrderedMapFunc")
+	}
 	m.root = m.insertNode(m.root, key, value)
 }
 
-func (m *OrderedMap) Erase(key int) {
+func (m *OrderedMap[K, V]) Erase(key K) {
+	if m.find(key) == nil {
+		return // don't copy the path to a missing key
+	}
 	m.root = m.removeNode(m.root, key)
 }
 
-func (m *OrderedMap) Contains(key int) bool {
-	return m.contains(m.root, key)
+func (m *tree[K, V]) Contains(key K) bool {
+	return m.find(key) != nil
 }
 
-func (m *OrderedMap) Size() int {
+func (m *tree[K, V]) Get(key K) (V, bool) {
+	if found := m.find(key); found != nil {
+		return found.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (m *tree[K, V]) Size() int {
 	return m.len
 }
 
-func (m *OrderedMap) ForEach(action func(int, int)) {
+func (m *tree[K, V]) ForEach(action func(K, V)) {
 	if action != nil {
 		m.forEach(m.root, action)
 	}
 }
 
+// All iterates over the map in ascending order of keys
+func (m *tree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		ascend(m.root, yield)
+	}
+}
+
+// Backward iterates over the map in descending order of keys
+func (m *tree[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		descend(m.root, yield)
+	}
+}
+
+// Floor returns the greatest entry with a key less than or equal to the key
+func (m *tree[K, V]) Floor(key K) (K, V, bool) {
+	return entry(m.below(key, true))
+}
+
+// Ceiling returns the least entry with a key greater than or equal to the key
+func (m *tree[K, V]) Ceiling(key K) (K, V, bool) {
+	return entry(m.above(key, true))
+}
+
+// Lower returns the greatest entry with a key strictly less than the key
+func (m *tree[K, V]) Lower(key K) (K, V, bool) {
+	return entry(m.below(key, false))
+}
+
+// Higher returns the least entry with a key strictly greater than the key
+func (m *tree[K, V]) Higher(key K) (K, V, bool) {
+	return entry(m.above(key, false))
+}
+
+func (m *tree[K, V]) Min() (K, V, bool) {
+	root := m.root
+	for root != nil && root.left != nil {
+		root = root.left
+	}
+	return entry(root)
+}
+
+func (m *tree[K, V]) Max() (K, V, bool) {
+	root := m.root
+	for root != nil && root.right != nil {
+		root = root.right
+	}
+	return entry(root)
+}
+
+// Range iterates in ascending order over keys in [from, to)
+func (m *tree[K, V]) Range(from, to K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.ascendRange(m.root, from, to, yield)
+	}
+}
+
+// Rank returns the number of keys strictly less than the key
+func (m *tree[K, V]) Rank(key K) int {
+	rank := 0
+	for root := m.root; root != nil; {
+		switch order := m.compare(key, root.key); {
+		case order < 0:
+			root = root.left
+		case order > 0:
+			rank += size(root.left) + 1
+			root = root.right
+		default:
+			return rank + size(root.left)
+		}
+	}
+	return rank
+}
+
+// Select returns the entry with the index-th smallest key starting from 0
+func (m *tree[K, V]) Select(index int) (K, V, bool) {
+	if index < 0 || index >= m.len {
+		return entry[K, V](nil)
+	}
+
+	root := m.root
+	for {
+		leftSize := size(root.left)
+		switch {
+		case index < leftSize:
+			root = root.left
+		case index > leftSize:
+			index -= leftSize + 1
+			root = root.right
+		default:
+			return entry(root)
+		}
+	}
+}
+
 func TestOrderedMap(t *testing.T) {
-	data := NewOrderedMap()
+	data := NewOrderedMap[int, int]()
 	assert.Zero(t, data.Size())
 
 	data.Insert(10, 10)
@@ -162,3 +532,386 @@ func TestOrderedMap(t *testing.T) {
 
 	assert.True(t, reflect.DeepEqual(expectedKeys, keys))
 }
+
+func TestOrderedMapZeroValue(t *testing.T) {
+	var data OrderedMap[int, int]
+	assert.Zero(t, data.Size())
+	assert.False(t, data.Contains(1))
+	data.Erase(1)
+
+	assert.PanicsWithValue(t, "OrderedMap must be created with NewOrderedMap or NewOrderedMapFunc", func() {
+		data.Insert(1, 1)
+	})
+	assert.Zero(t, data.Size())
+}
+
+func TestOrderedMapSortedInsertion(t *testing.T) {
+	const keysNumber = 1 << 16
+
+	data := NewOrderedMap[int, int]()
+	for i := 0; i < keysNumber; i++ {
+		data.Insert(i, i)
+	}
+
+	assert.NoError(t, data.checkInvariants())
+	assert.Equal(t, keysNumber, data.Size())
+	assert.LessOrEqual(t, float64(height(data.root)), 1.45*math.Log2(keysNumber+2))
+
+	for i := 0; i < keysNumber; i += 2 {
+		data.Erase(i)
+	}
+
+	assert.NoError(t, data.checkInvariants())
+	assert.Equal(t, keysNumber/2, data.Size())
+}
+
+type operation struct {
+	Erase bool
+	Key   int8
+}
+
+func TestOrderedMapProperties(t *testing.T) {
+	property := func(operations []operation) bool {
+		data := NewOrderedMap[int, int]()
+		expected := make(map[int]int)
+
+		for i, operation := range operations {
+			key := int(operation.Key)
+			if operation.Erase {
+				data.Erase(key)
+				delete(expected, key)
+			} else {
+				data.Insert(key, i)
+				expected[key] = i
+			}
+
+			if err := data.checkInvariants(); err != nil {
+				t.Log(err)
+				return false
+			}
+		}
+
+		expectedKeys := make([]int, 0, len(expected))
+		for key := range expected {
+			expectedKeys = append(expectedKeys, key)
+		}
+		slices.Sort(expectedKeys)
+
+		var keys []int
+		correct := true
+		data.ForEach(func(key, value int) {
+			keys = append(keys, key)
+			correct = correct && expected[key] == value && data.Contains(key)
+		})
+
+		return correct && data.Size() == len(expected) && slices.Equal(expectedKeys, keys)
+	}
+
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 500}))
+}
+
+const benchmarkKeysNumber = 1_000_000
+
+func BenchmarkOrderedMapSequentialInsert(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		data := NewOrderedMap[int, int]()
+		for key := 0; key < benchmarkKeysNumber; key++ {
+			data.Insert(key, key)
+		}
+	}
+}
+
+func BenchmarkOrderedMapRandomInsert(b *testing.B) {
+	keys := rand.Perm(benchmarkKeysNumber)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data := NewOrderedMap[int, int]()
+		for _, key := range keys {
+			data.Insert(key, key)
+		}
+	}
+}
+
+func TestOrderedMapGeneric(t *testing.T) {
+	data := NewOrderedMap[string, []int]()
+	data.Insert("b", []int{2})
+	data.Insert("a", []int{1})
+	data.Insert("c", []int{3})
+
+	value, found := data.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, []int{1}, value)
+
+	value, found = data.Get("d")
+	assert.False(t, found)
+	assert.Nil(t, value)
+
+	var keys []string
+	for key := range data.All() {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	keys = nil
+	for key := range data.Backward() {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"c", "b", "a"}, keys)
+}
+
+func TestOrderedMapFunc(t *testing.T) {
+	data := NewOrderedMapFunc[string, int](func(a, b string) int {
+		return cmp.Compare(len(a), len(b))
+	})
+	data.Insert("ccc", 3)
+	data.Insert("a", 1)
+	data.Insert("bb", 2)
+	data.Insert("dd", 4) // the same length replaces the value
+
+	assert.Equal(t, 3, data.Size())
+	assert.NoError(t, data.checkInvariants())
+
+	value, found := data.Get("xx")
+	assert.True(t, found)
+	assert.Equal(t, 4, value)
+
+	var values []int
+	for _, value := range data.All() {
+		values = append(values, value)
+	}
+	assert.Equal(t, []int{1, 4, 3}, values)
+}
+
+func TestOrderedMapIteratorBreak(t *testing.T) {
+	data := NewOrderedMap[int, int]()
+	for i := 0; i < 100; i++ {
+		data.Insert(i, i*i)
+	}
+
+	var keys []int
+	for key, value := range data.All() {
+		if key == 5 {
+			break
+		}
+		assert.Equal(t, key*key, value)
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, keys)
+
+	keys = nil
+	for key := range data.Backward() {
+		if key < 97 {
+			break
+		}
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []int{99, 98, 97}, keys)
+}
+
+func TestOrderedMapNavigation(t *testing.T) {
+	data := NewOrderedMap[int, string]()
+	_, _, found := data.Min()
+	assert.False(t, found)
+	_, _, found = data.Floor(10)
+	assert.False(t, found)
+
+	for _, key := range []int{10, 20, 30, 40, 50} {
+		data.Insert(key, fmt.Sprint(key))
+	}
+
+	tests := []struct {
+		name     string
+		navigate func(int) (int, string, bool)
+		key      int
+		expected int
+		found    bool
+	}{
+		{"floor exact", data.Floor, 30, 30, true},
+		{"floor between", data.Floor, 35, 30, true},
+		{"floor below min", data.Floor, 5, 0, false},
+		{"ceiling exact", data.Ceiling, 30, 30, true},
+		{"ceiling between", data.Ceiling, 35, 40, true},
+		{"ceiling above max", data.Ceiling, 55, 0, false},
+		{"lower exact", data.Lower, 30, 20, true},
+		{"lower min", data.Lower, 10, 0, false},
+		{"higher exact", data.Higher, 30, 40, true},
+		{"higher max", data.Higher, 50, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, value, found := test.navigate(test.key)
+			assert.Equal(t, test.found, found)
+			assert.Equal(t, test.expected, key)
+			if found {
+				assert.Equal(t, fmt.Sprint(test.expected), value)
+			}
+		})
+	}
+
+	key, _, found := data.Min()
+	assert.True(t, found)
+	assert.Equal(t, 10, key)
+
+	key, _, found = data.Max()
+	assert.True(t, found)
+	assert.Equal(t, 50, key)
+
+	var keys []int
+	for key := range data.Range(15, 40) {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []int{20, 30}, keys)
+
+	keys = nil
+	for key := range data.Range(0, 100) {
+		if key > 20 {
+			break
+		}
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []int{10, 20}, keys)
+}
+
+func TestOrderedMapOrderStatistics(t *testing.T) {
+	const keysNumber = 1000
+
+	data := NewOrderedMap[int, int]()
+	for _, key := range rand.Perm(keysNumber) {
+		data.Insert(key*2, key)
+	}
+	for key := 0; key < keysNumber; key += 3 {
+		data.Erase(key * 2)
+	}
+	assert.NoError(t, data.checkInvariants())
+
+	index := 0
+	for key := range data.All() {
+		assert.Equal(t, index, data.Rank(key))
+		assert.Equal(t, index+1, data.Rank(key+1))
+
+		selected, _, found := data.Select(index)
+		assert.True(t, found)
+		assert.Equal(t, key, selected)
+		index++
+	}
+
+	assert.Equal(t, 0, data.Rank(-1))
+	assert.Equal(t, data.Size(), data.Rank(keysNumber*2))
+
+	_, _, found := data.Select(-1)
+	assert.False(t, found)
+	_, _, found = data.Select(data.Size())
+	assert.False(t, found)
+}
+
+func collect[K, V any](sequence iter.Seq2[K, V]) []K {
+	var keys []K
+	for key := range sequence {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestOrderedMapSnapshot(t *testing.T) {
+	data := NewOrderedMap[int, int]()
+	for i := 0; i < 10; i++ {
+		data.Insert(i, i)
+	}
+
+	snapshot := data.Snapshot()
+	data.Insert(100, 100)
+	data.Insert(5, 50)
+	data.Erase(0)
+	data.Erase(1)
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, collect(snapshot.All()))
+	assert.Equal(t, 10, snapshot.Size())
+	assert.False(t, snapshot.Contains(100))
+	value, _ := snapshot.Get(5)
+	assert.Equal(t, 5, value)
+	assert.NoError(t, snapshot.checkInvariants())
+
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 7, 8, 9, 100}, collect(data.All()))
+	value, _ = data.Get(5)
+	assert.Equal(t, 50, value)
+	assert.NoError(t, data.checkInvariants())
+
+	// iteration over a snapshot is consistent during writes
+	var keys []int
+	for key := range snapshot.All() {
+		data.Erase(key)
+		data.Insert(-key, key)
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, keys)
+	assert.NoError(t, data.checkInvariants())
+}
+
+func TestOrderedMapSnapshotProperties(t *testing.T) {
+	property := func(operations []operation) bool {
+		data := NewOrderedMap[int, int]()
+		expected := make(map[int]int)
+
+		var snapshots []Snapshot[int, int]
+		var expectedSnapshots [][]int
+
+		for i, operation := range operations {
+			if i%8 == 0 {
+				snapshots = append(snapshots, data.Snapshot())
+				expectedSnapshots = append(expectedSnapshots, collect(data.All()))
+			}
+
+			key := int(operation.Key)
+			if operation.Erase {
+				data.Erase(key)
+				delete(expected, key)
+			} else {
+				data.Insert(key, i)
+				expected[key] = i
+			}
+		}
+
+		for i, snapshot := range snapshots {
+			if snapshot.checkInvariants() != nil || !slices.Equal(expectedSnapshots[i], collect(snapshot.All())) {
+				return false
+			}
+		}
+		return data.checkInvariants() == nil && data.Size() == len(expected)
+	}
+
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 200}))
+}
+
+func TestOrderedMapSnapshotAllocations(t *testing.T) {
+	const keysNumber = 1 << 14
+
+	data := NewOrderedMap[int, int]()
+	for i := 0; i < keysNumber; i++ {
+		data.Insert(i*2, i)
+	}
+
+	// without snapshots nodes are updated in place
+	allocations := testing.AllocsPerRun(100, func() {
+		data.Insert(keysNumber, 0)
+	})
+	assert.Zero(t, allocations)
+
+	maxAllocations := float64(2 * height(data.root))
+	key := 1
+	allocations = testing.AllocsPerRun(100, func() {
+		_ = data.Snapshot()
+		data.Insert(key, key)
+		key += 2
+	})
+	assert.LessOrEqual(t, allocations, maxAllocations)
+
+	allocations = testing.AllocsPerRun(100, func() {
+		_ = data.Snapshot()
+		key -= 2
+		data.Erase(key)
+	})
+	assert.LessOrEqual(t, allocations, maxAllocations)
+	assert.NoError(t, data.checkInvariants())
+}
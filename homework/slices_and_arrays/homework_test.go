@@ -1,8 +1,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"iter"
 	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,49 +21,83 @@ type IntNum interface {
 	int | int8 | int16 | int32 | int64
 }
 
-type CircularQueue[T IntNum] struct {
-	values []T
-	len    int
-	write  int
-	read   int
+type queueOptions struct {
+	overwrite bool
+}
+
+type QueueOption func(*queueOptions)
+
+// WithOverwrite makes Push replace the oldest value
+// when the queue is full instead of failing
+func WithOverwrite() QueueOption {
+	return func(options *queueOptions) {
+		options.overwrite = true
+	}
 }
 
-func NewCircularQueue[T IntNum](size int) CircularQueue[T] {
+type CircularQueue[T any] struct {
+	values    []T
+	len       int
+	write     int
+	read      int
+	overwrite bool
+}
+
+func NewCircularQueueOf[T any](size int, options ...QueueOption) CircularQueue[T] {
+	var queueOptions queueOptions
+	for _, option := range options {
+		option(&queueOptions)
+	}
+
 	return CircularQueue[T]{
-		values: make([]T, size),
+		values:    make([]T, size),
+		overwrite: queueOptions.overwrite,
 	}
 }
+
 func (q *CircularQueue[T]) Push(value T) bool {
-	if q.Full() {
+	if len(q.values) == 0 {
 		return false
 	}
+	if q.Full() {
+		if !q.overwrite {
+			return false
+		}
+		q.read = (q.read + 1) % len(q.values)
+		q.len--
+	}
 	q.values[q.write] = value
 	q.write = (q.write + 1) % len(q.values)
 	q.len++
 	return true
 }
 
-func (q *CircularQueue[T]) Pop() bool {
+func (q *CircularQueue[T]) Pop() (T, bool) {
+	var zero T
 	if q.Empty() {
-		return false
+		return zero, false
 	}
+	value := q.values[q.read]
+	q.values[q.read] = zero // don't keep references for GC
 	q.read = (q.read + 1) % len(q.values)
 	q.len--
-	return true
+	return value, true
 }
 
-func (q *CircularQueue[T]) Front() T {
+func (q *CircularQueue[T]) Front() (T, bool) {
 	if q.Empty() {
-		return -1
+		var zero T
+		return zero, false
 	}
-	return q.values[q.read]
+	return q.values[q.read], true
 }
 
-func (q *CircularQueue[T]) Back() T {
+func (q *CircularQueue[T]) Back() (T, bool) {
 	if q.Empty() {
-		return -1
+		var zero T
+		return zero, false
 	}
-	return q.values[(q.write-1+len(q.values))%len(q.values)]
+	return q.values[(q.write-1+len(q.values))%len(q.values)], true
 }
 
 func (q *CircularQueue[T]) Empty() bool {
@@ -66,6 +108,266 @@ func (q *CircularQueue[T]) Full() bool {
 	return q.len == len(q.values)
 }
 
+func (q *CircularQueue[T]) Len() int {
+	return q.len
+}
+
+func (q *CircularQueue[T]) Cap() int {
+	return len(q.values)
+}
+
+// All iterates from the oldest value to the newest one
+func (q *CircularQueue[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for i := 0; i < q.len; i++ {
+			if !yield(q.values[(q.read+i)%len(q.values)]) {
+				return
+			}
+		}
+	}
+}
+
+// IntCircularQueue keeps the previous API where
+// -1 is returned from an empty queue
+type IntCircularQueue[T IntNum] struct {
+	CircularQueue[T]
+}
+
+func NewCircularQueue[T IntNum](size int) IntCircularQueue[T] {
+	return IntCircularQueue[T]{
+		CircularQueue: NewCircularQueueOf[T](size),
+	}
+}
+
+func (q *IntCircularQueue[T]) Pop() bool {
+	_, ok := q.CircularQueue.Pop()
+	return ok
+}
+
+func (q *IntCircularQueue[T]) Front() T {
+	if value, ok := q.CircularQueue.Front(); ok {
+		return value
+	}
+	return -1
+}
+
+func (q *IntCircularQueue[T]) Back() T {
+	if value, ok := q.CircularQueue.Back(); ok {
+		return value
+	}
+	return -1
+}
+
+const cacheLineSize = 64
+
+// waitFor retries the action with backoff until it succeeds
+// or the context is done
+func waitFor(ctx context.Context, action func() bool) error {
+	for attempt := 0; ; attempt++ {
+		if action() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if attempt < 16 {
+			runtime.Gosched()
+		} else {
+			time.Sleep(min(time.Microsecond<<(attempt-16), time.Millisecond))
+		}
+	}
+}
+
+// SPSCRing is a lock-free queue for one producer and one consumer,
+// the producer only writes tail and the consumer only writes head
+type SPSCRing[T any] struct {
+	values []T
+	_      [cacheLineSize - 24]byte
+	head   atomic.Uint64
+	_      [cacheLineSize - 8]byte
+	tail   atomic.Uint64
+	_      [cacheLineSize - 8]byte
+}
+
+func NewSPSCRing[T any](size int) *SPSCRing[T] {
+	if size <= 0 {
+		panic("incorrect ring size")
+	}
+	return &SPSCRing[T]{values: make([]T, size)}
+}
+
+func (r *SPSCRing[T]) Push(value T) bool {
+	tail := r.tail.Load()
+	if tail-r.head.Load() == uint64(len(r.values)) {
+		return false
+	}
+	r.values[tail%uint64(len(r.values))] = value
+	r.tail.Store(tail + 1)
+	return true
+}
+
+func (r *SPSCRing[T]) Pop() (T, bool) {
+	var zero T
+	head := r.head.Load()
+	if head == r.tail.Load() {
+		return zero, false
+	}
+	index := head % uint64(len(r.values))
+	value := r.values[index]
+	r.values[index] = zero
+	r.head.Store(head + 1)
+	return value, true
+}
+
+func (r *SPSCRing[T]) Empty() bool {
+	return r.head.Load() == r.tail.Load()
+}
+
+func (r *SPSCRing[T]) Full() bool {
+	return r.tail.Load()-r.head.Load() == uint64(len(r.values))
+}
+
+func (r *SPSCRing[T]) PushContext(ctx context.Context, value T) error {
+	return waitFor(ctx, func() bool {
+		return r.Push(value)
+	})
+}
+
+func (r *SPSCRing[T]) PopContext(ctx context.Context) (T, error) {
+	var value T
+	err := waitFor(ctx, func() bool {
+		var ok bool
+		value, ok = r.Pop()
+		return ok
+	})
+	return value, err
+}
+
+func (r *SPSCRing[T]) PushBlocking(value T) {
+	_ = r.PushContext(context.Background(), value)
+}
+
+func (r *SPSCRing[T]) PopBlocking() T {
+	value, _ := r.PopContext(context.Background())
+	return value
+}
+
+type slot[T any] struct {
+	sequence atomic.Uint64
+	value    T
+}
+
+// MPMCRing is a bounded lock-free queue by Dmitry Vyukov, every slot
+// has a sequence number that tells producers and consumers whether
+// the slot is ready for them on the current lap
+type MPMCRing[T any] struct {
+	slots   []slot[T]
+	mask    uint64
+	_       [cacheLineSize - 32]byte
+	enqueue atomic.Uint64
+	_       [cacheLineSize - 8]byte
+	dequeue atomic.Uint64
+	_       [cacheLineSize - 8]byte
+}
+
+// NewMPMCRing rounds the size up to a power of two
+func NewMPMCRing[T any](size int) *MPMCRing[T] {
+	if size <= 0 {
+		panic("incorrect ring size")
+	}
+
+	capacity := 2
+	for capacity < size {
+		capacity <<= 1
+	}
+
+	ring := &MPMCRing[T]{
+		slots: make([]slot[T], capacity),
+		mask:  uint64(capacity - 1),
+	}
+	for i := range ring.slots {
+		ring.slots[i].sequence.Store(uint64(i))
+	}
+	return ring
+}
+
+func (r *MPMCRing[T]) Push(value T) bool {
+	position := r.enqueue.Load()
+	for {
+		slot := &r.slots[position&r.mask]
+		switch difference := int64(slot.sequence.Load() - position); {
+		case difference == 0:
+			if r.enqueue.CompareAndSwap(position, position+1) {
+				slot.value = value
+				slot.sequence.Store(position + 1)
+				return true
+			}
+			position = r.enqueue.Load()
+		case difference < 0:
+			return false // the slot isn't consumed on the previous lap
+		default:
+			position = r.enqueue.Load()
+		}
+	}
+}
+
+func (r *MPMCRing[T]) Pop() (T, bool) {
+	var zero T
+	position := r.dequeue.Load()
+	for {
+		slot := &r.slots[position&r.mask]
+		switch difference := int64(slot.sequence.Load() - (position + 1)); {
+		case difference == 0:
+			if r.dequeue.CompareAndSwap(position, position+1) {
+				value := slot.value
+				slot.value = zero
+				slot.sequence.Store(position + r.mask + 1)
+				return value, true
+			}
+			position = r.dequeue.Load()
+		case difference < 0:
+			return zero, false // the slot isn't produced on this lap
+		default:
+			position = r.dequeue.Load()
+		}
+	}
+}
+
+// Empty and Full are only approximations under concurrent access
+func (r *MPMCRing[T]) Empty() bool {
+	return r.enqueue.Load() <= r.dequeue.Load()
+}
+
+func (r *MPMCRing[T]) Full() bool {
+	return r.enqueue.Load()-r.dequeue.Load() >= uint64(len(r.slots))
+}
+
+func (r *MPMCRing[T]) PushContext(ctx context.Context, value T) error {
+	return waitFor(ctx, func() bool {
+		return r.Push(value)
+	})
+}
+
+func (r *MPMCRing[T]) PopContext(ctx context.Context) (T, error) {
+	var value T
+	err := waitFor(ctx, func() bool {
+		var ok bool
+		value, ok = r.Pop()
+		return ok
+	})
+	return value, err
+}
+
+func (r *MPMCRing[T]) PushBlocking(value T) {
+	_ = r.PushContext(context.Background(), value)
+}
+
+func (r *MPMCRing[T]) PopBlocking() T {
+	value, _ := r.PopContext(context.Background())
+	return value
+}
+
 func TestCircularQueue(t *testing.T) {
 	const queueSize = 3
 	queue := NewCircularQueue[int](queueSize)
@@ -108,3 +410,254 @@ func TestCircularQueue(t *testing.T) {
 	assert.True(t, queue.Empty())
 	assert.False(t, queue.Full())
 }
+
+func TestGenericCircularQueue(t *testing.T) {
+	queue := NewCircularQueueOf[string](2)
+	assert.Equal(t, 0, queue.Len())
+	assert.Equal(t, 2, queue.Cap())
+
+	_, ok := queue.Front()
+	assert.False(t, ok)
+	_, ok = queue.Back()
+	assert.False(t, ok)
+	_, ok = queue.Pop()
+	assert.False(t, ok)
+
+	assert.True(t, queue.Push("a"))
+	assert.True(t, queue.Push("b"))
+	assert.False(t, queue.Push("c"))
+	assert.Equal(t, []string{"a", "b"}, slices.Collect(queue.All()))
+
+	front, ok := queue.Front()
+	assert.True(t, ok)
+	assert.Equal(t, "a", front)
+
+	back, ok := queue.Back()
+	assert.True(t, ok)
+	assert.Equal(t, "b", back)
+
+	value, ok := queue.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+	assert.Equal(t, []string{"", "b"}, queue.values)
+
+	assert.True(t, queue.Push("c"))
+	assert.Equal(t, []string{"b", "c"}, slices.Collect(queue.All()))
+	assert.Equal(t, 2, queue.Len())
+}
+
+func TestCircularQueueWithOverwrite(t *testing.T) {
+	history := NewCircularQueueOf[int](3, WithOverwrite())
+	for i := 1; i <= 5; i++ {
+		assert.True(t, history.Push(i))
+	}
+
+	assert.True(t, history.Full())
+	assert.Equal(t, 3, history.Len())
+	assert.Equal(t, []int{3, 4, 5}, slices.Collect(history.All()))
+
+	front, _ := history.Front()
+	assert.Equal(t, 3, front)
+	back, _ := history.Back()
+	assert.Equal(t, 5, back)
+
+	var values []int
+	for value := range history.All() {
+		if value == 4 {
+			break
+		}
+		values = append(values, value)
+	}
+	assert.Equal(t, []int{3}, values)
+}
+
+func TestSPSCRing(t *testing.T) {
+	ring := NewSPSCRing[int](2)
+	assert.True(t, ring.Empty())
+	_, ok := ring.Pop()
+	assert.False(t, ok)
+
+	assert.True(t, ring.Push(1))
+	assert.True(t, ring.Push(2))
+	assert.False(t, ring.Push(3))
+	assert.True(t, ring.Full())
+
+	value, ok := ring.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	assert.True(t, ring.Push(3))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.ErrorIs(t, ring.PushContext(ctx, 4), context.DeadlineExceeded)
+
+	assert.Equal(t, 2, ring.PopBlocking())
+	assert.Equal(t, 3, ring.PopBlocking())
+
+	const valuesNumber = 10000
+	go func() {
+		for i := 0; i < valuesNumber; i++ {
+			ring.PushBlocking(i)
+		}
+	}()
+
+	for i := 0; i < valuesNumber; i++ {
+		assert.Equal(t, i, ring.PopBlocking())
+	}
+	assert.True(t, ring.Empty())
+}
+
+func TestMPMCRing(t *testing.T) {
+	ring := NewMPMCRing[int](3)
+	assert.Len(t, ring.slots, 4)
+	assert.True(t, ring.Empty())
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, ring.Push(i))
+	}
+	assert.False(t, ring.Push(4))
+	assert.True(t, ring.Full())
+
+	for i := 0; i < 4; i++ {
+		value, ok := ring.Pop()
+		assert.True(t, ok)
+		assert.Equal(t, i, value)
+	}
+	_, ok := ring.Pop()
+	assert.False(t, ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err := ring.PopContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMPMCRingConcurrency(t *testing.T) {
+	const producersNumber = 8
+	const consumersNumber = 8
+	const valuesNumber = 10000
+
+	ring := NewMPMCRing[int](64)
+	var produced, consumed sync.WaitGroup
+	produced.Add(producersNumber)
+	for producer := 0; producer < producersNumber; producer++ {
+		go func() {
+			defer produced.Done()
+			for i := 0; i < valuesNumber; i++ {
+				ring.PushBlocking(producer*valuesNumber + i)
+			}
+		}()
+	}
+
+	results := make([][]int, consumersNumber)
+	consumed.Add(consumersNumber)
+	for consumer := 0; consumer < consumersNumber; consumer++ {
+		go func() {
+			defer consumed.Done()
+			for i := 0; i < valuesNumber*producersNumber/consumersNumber; i++ {
+				results[consumer] = append(results[consumer], ring.PopBlocking())
+			}
+		}()
+	}
+
+	produced.Wait()
+	consumed.Wait()
+
+	var values []int
+	for _, result := range results {
+		values = append(values, result...)
+	}
+	slices.Sort(values)
+	for i, value := range values {
+		assert.Equal(t, i, value)
+	}
+	assert.Len(t, values, valuesNumber*producersNumber)
+	assert.True(t, ring.Empty())
+}
+
+type MutexQueue struct {
+	mutex sync.Mutex
+	queue CircularQueue[int]
+}
+
+func (q *MutexQueue) Push(value int) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.queue.Push(value)
+}
+
+func (q *MutexQueue) Pop() (int, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.queue.Pop()
+}
+
+type ChannelQueue chan int
+
+func (q ChannelQueue) Push(value int) bool {
+	select {
+	case q <- value:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q ChannelQueue) Pop() (int, bool) {
+	select {
+	case value := <-q:
+		return value, true
+	default:
+		return 0, false
+	}
+}
+
+const benchmarkQueueSize = 1024
+
+// benchmarkQueue transfers b.N values from producers to one consumer
+func benchmarkQueue(b *testing.B, producersNumber int, push func(int) bool, pop func() (int, bool)) {
+	var wg sync.WaitGroup
+	wg.Add(producersNumber)
+	for producer := 0; producer < producersNumber; producer++ {
+		go func() {
+			defer wg.Done()
+			for i := producer; i < b.N; i += producersNumber {
+				for !push(i) {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < b.N; i++ {
+		for {
+			if _, ok := pop(); ok {
+				break
+			}
+			runtime.Gosched()
+		}
+	}
+	wg.Wait()
+}
+
+func BenchmarkQueues(b *testing.B) {
+	b.Run("SPSCRing/producers=1", func(b *testing.B) {
+		ring := NewSPSCRing[int](benchmarkQueueSize)
+		benchmarkQueue(b, 1, ring.Push, ring.Pop)
+	})
+
+	for _, producersNumber := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("MPMCRing/producers=%d", producersNumber), func(b *testing.B) {
+			ring := NewMPMCRing[int](benchmarkQueueSize)
+			benchmarkQueue(b, producersNumber, ring.Push, ring.Pop)
+		})
+		b.Run(fmt.Sprintf("Channel/producers=%d", producersNumber), func(b *testing.B) {
+			queue := make(ChannelQueue, benchmarkQueueSize)
+			benchmarkQueue(b, producersNumber, queue.Push, queue.Pop)
+		})
+		b.Run(fmt.Sprintf("MutexCircularQueue/producers=%d", producersNumber), func(b *testing.B) {
+			queue := &MutexQueue{queue: NewCircularQueueOf[int](benchmarkQueueSize)}
+			benchmarkQueue(b, producersNumber, queue.Push, queue.Pop)
+		})
+	}
+}
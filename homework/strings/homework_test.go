@@ -1,28 +1,35 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// COWBuffer can be cloned and updated from different goroutines,
+// but every COWBuffer value must be used by one goroutine at a time
 type COWBuffer struct {
 	data []byte
-	refs *int
+	refs *atomic.Int64
 }
 
 func NewCOWBuffer(data []byte) COWBuffer {
-	var refs int = 1 // add this reference
+	refs := new(atomic.Int64)
+	refs.Store(1) // add this reference
 	return COWBuffer{
 		data: data,
-		refs: &refs,
+		refs: refs,
 	}
 }
 
 func (b *COWBuffer) Clone() COWBuffer {
-	*b.refs++
+	b.refs.Add(1)
 	return COWBuffer{
 		data: b.data,
 		refs: b.refs,
@@ -30,9 +37,10 @@ func (b *COWBuffer) Clone() COWBuffer {
 }
 
 func (b *COWBuffer) Close() {
-	if *b.refs > 0 {
-		*b.refs--
+	if b.refs == nil {
+		return
 	}
+	b.refs.Add(-1)
 	b.data = nil
 	b.refs = nil
 }
@@ -42,11 +50,15 @@ func (b *COWBuffer) Update(index int, value byte) bool {
 		return false
 	}
 
-	if *b.refs != 1 {
-		*b.refs--
-		b.refs = new(int)
-		*b.refs++
-		b.data = append([]byte(nil), b.data...)
+	if b.refs.Load() != 1 {
+		// the copy must be completed before the reference is released,
+		// otherwise the last owner could start writing in place
+		data := append([]byte(nil), b.data...)
+		b.refs.Add(-1)
+
+		b.refs = new(atomic.Int64)
+		b.refs.Store(1)
+		b.data = data
 	}
 	b.data[index] = value
 	return true
@@ -56,6 +68,198 @@ func (b *COWBuffer) String() string {
 	return unsafe.String(unsafe.SliceData(b.data), len(b.data))
 }
 
+const defaultPageSize = 4096
+
+type page struct {
+	data []byte // always has the page size
+	refs atomic.Int64
+}
+
+func newPage(size int) *page {
+	p := &page{data: make([]byte, size)}
+	p.refs.Store(1)
+	return p
+}
+
+// ChunkedCOWBuffer splits data into pages with separate reference
+// counters, so an update copies only one page instead of all data,
+// the same goroutine rules as for COWBuffer are applied, the zero
+// value is an empty buffer with the default page size
+type ChunkedCOWBuffer struct {
+	pages    []*page
+	pageSize int
+	offset   int // offset of the first byte in the first page
+	length   int
+	position int // read position for io.Reader
+}
+
+func NewChunkedCOWBuffer(data []byte, pageSize int) ChunkedCOWBuffer {
+	if pageSize <= 0 {
+		panic("incorrect page size")
+	}
+
+	buffer := ChunkedCOWBuffer{pageSize: pageSize}
+	buffer.Append(data...)
+	return buffer
+}
+
+func (b *ChunkedCOWBuffer) Clone() ChunkedCOWBuffer {
+	for _, page := range b.pages {
+		page.refs.Add(1)
+	}
+	return ChunkedCOWBuffer{
+		pages:    append([]*page(nil), b.pages...),
+		pageSize: b.pageSize,
+		offset:   b.offset,
+		length:   b.length,
+	}
+}
+
+// Slice returns a buffer for bytes in [from, to)
+// that shares pages with this buffer
+func (b *ChunkedCOWBuffer) Slice(from, to int) (ChunkedCOWBuffer, bool) {
+	if from < 0 || to < from || to > b.length {
+		return ChunkedCOWBuffer{}, false
+	}
+
+	pageSize := b.size()
+	slice := ChunkedCOWBuffer{
+		pageSize: pageSize,
+		offset:   (b.offset + from) % pageSize,
+		length:   to - from,
+	}
+	if from == to {
+		return slice, true
+	}
+
+	first := (b.offset + from) / pageSize
+	last := (b.offset + to - 1) / pageSize
+	slice.pages = append([]*page(nil), b.pages[first:last+1]...)
+	for _, page := range slice.pages {
+		page.refs.Add(1)
+	}
+	return slice, true
+}
+
+func (b *ChunkedCOWBuffer) Close() {
+	for _, page := range b.pages {
+		page.refs.Add(-1)
+	}
+	*b = ChunkedCOWBuffer{pageSize: b.pageSize}
+}
+
+func (b *ChunkedCOWBuffer) Len() int {
+	return b.length
+}
+
+func (b *ChunkedCOWBuffer) size() int {
+	if b.pageSize == 0 {
+		return defaultPageSize
+	}
+	return b.pageSize
+}
+
+func (b *ChunkedCOWBuffer) capacity() int {
+	return len(b.pages)*b.pageSize - b.offset
+}
+
+// mutablePage copies the page if it's shared with other buffers
+func (b *ChunkedCOWBuffer) mutablePage(index int) *page {
+	shared := b.pages[index]
+	if shared.refs.Load() == 1 {
+		return shared
+	}
+
+	// the copy must be completed before the reference is released
+	copied := newPage(b.pageSize)
+	copy(copied.data, shared.data)
+	shared.refs.Add(-1)
+
+	b.pages[index] = copied
+	return copied
+}
+
+// write expects that data fits into the capacity, a partially used
+// last page is also copied if it's shared, because another buffer
+// could have appended to its tail
+func (b *ChunkedCOWBuffer) write(data []byte, offset int) {
+	for len(data) != 0 {
+		index, position := (b.offset+offset)/b.pageSize, (b.offset+offset)%b.pageSize
+		written := copy(b.mutablePage(index).data[position:], data)
+		data = data[written:]
+		offset += written
+	}
+}
+
+func (b *ChunkedCOWBuffer) read(data []byte, offset int) int {
+	data = data[:min(len(data), b.length-offset)]
+	total := 0
+	for total < len(data) {
+		index, position := (b.offset+offset)/b.pageSize, (b.offset+offset)%b.pageSize
+		read := copy(data[total:], b.pages[index].data[position:])
+		total += read
+		offset += read
+	}
+	return total
+}
+
+func (b *ChunkedCOWBuffer) grow(length int) {
+	b.pageSize = b.size()
+	for b.capacity() < length {
+		b.pages = append(b.pages, newPage(b.pageSize))
+	}
+}
+
+func (b *ChunkedCOWBuffer) Update(index int, value byte) bool {
+	if index < 0 || index >= b.length {
+		return false
+	}
+
+	b.write([]byte{value}, index)
+	return true
+}
+
+func (b *ChunkedCOWBuffer) Append(data ...byte) {
+	b.grow(b.length + len(data))
+	b.write(data, b.length)
+	b.length += len(data)
+}
+
+// Read implements io.Reader starting from the first byte
+func (b *ChunkedCOWBuffer) Read(data []byte) (int, error) {
+	if b.position >= b.length {
+		return 0, io.EOF
+	}
+
+	read := b.read(data, b.position)
+	b.position += read
+	return read, nil
+}
+
+// WriteAt implements io.WriterAt, writing beyond the end
+// extends the buffer and fills the gap with zeros
+func (b *ChunkedCOWBuffer) WriteAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	end := int(offset) + len(data)
+	if end > b.length {
+		b.grow(end)
+		b.write(make([]byte, end-b.length), b.length)
+		b.length = end
+	}
+
+	b.write(data, int(offset))
+	return len(data), nil
+}
+
+func (b *ChunkedCOWBuffer) Bytes() []byte {
+	data := make([]byte, b.length)
+	b.read(data, 0)
+	return data
+}
+
 func TestCOWBuffer(t *testing.T) {
 	data := []byte{'a', 'b', 'c', 'd'}
 	buffer := NewCOWBuffer(data)
@@ -94,3 +298,210 @@ func TestCOWBuffer(t *testing.T) {
 
 	copy2.Close()
 }
+
+func TestCOWBufferConcurrency(t *testing.T) {
+	const goroutinesNumber = 32
+	const iterationsNumber = 200
+
+	original := []byte("0123456789abcdef")
+	buffer := NewCOWBuffer(append([]byte(nil), original...))
+	defer buffer.Close()
+
+	// every byte either has the original value or the value
+	// written by the owner of the buffer
+	isolated := func(data []byte, id byte) bool {
+		for i, value := range data {
+			if value != original[i] && value != id {
+				return false
+			}
+		}
+		return true
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(goroutinesNumber)
+	for goroutine := 0; goroutine < goroutinesNumber; goroutine++ {
+		go func() {
+			defer wg.Done()
+
+			id := byte('A' + goroutine)
+			clone := buffer.Clone()
+			defer clone.Close()
+
+			for i := 0; i < iterationsNumber; i++ {
+				expectedClone := append([]byte(nil), clone.data...)
+				expectedNested := append([]byte(nil), clone.data...)
+				expectedClone[i%len(original)] = id
+				expectedNested[(i+1)%len(original)] = id + goroutinesNumber
+
+				nested := clone.Clone()
+				assert.True(t, clone.Update(i%len(original), id))
+				assert.True(t, nested.Update((i+1)%len(original), id+goroutinesNumber))
+
+				assert.Equal(t, expectedClone, clone.data)
+				assert.Equal(t, expectedNested, nested.data)
+				assert.True(t, isolated(clone.data, id))
+				nested.Close()
+			}
+
+			assert.Equal(t, int64(1), clone.refs.Load())
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, original, buffer.data)
+	assert.Equal(t, int64(1), buffer.refs.Load())
+}
+
+var (
+	_ io.Reader   = (*ChunkedCOWBuffer)(nil)
+	_ io.WriterAt = (*ChunkedCOWBuffer)(nil)
+)
+
+func TestChunkedCOWBuffer(t *testing.T) {
+	buffer := NewChunkedCOWBuffer([]byte("aaaabbbbccccdd"), 4)
+	defer buffer.Close()
+	assert.Len(t, buffer.pages, 4)
+	assert.Equal(t, 14, buffer.Len())
+
+	clone := buffer.Clone()
+	defer clone.Close()
+
+	assert.True(t, clone.Update(5, 'X'))
+	assert.False(t, clone.Update(14, 'X'))
+	assert.False(t, clone.Update(-1, 'X'))
+
+	assert.Equal(t, []byte("aaaabbbbccccdd"), buffer.Bytes())
+	assert.Equal(t, []byte("aaaabXbbccccdd"), clone.Bytes())
+
+	// only the updated page is copied
+	assert.Same(t, buffer.pages[0], clone.pages[0])
+	assert.NotSame(t, buffer.pages[1], clone.pages[1])
+	assert.Same(t, buffer.pages[2], clone.pages[2])
+	assert.Same(t, buffer.pages[3], clone.pages[3])
+
+	previous := clone.pages[1]
+	assert.True(t, clone.Update(6, 'Y'))
+	assert.Same(t, previous, clone.pages[1]) // 1 reference - don't need to copy
+}
+
+func TestChunkedCOWBufferSlice(t *testing.T) {
+	buffer := NewChunkedCOWBuffer([]byte("aaaabbbbccccdd"), 4)
+	defer buffer.Close()
+
+	slice, ok := buffer.Slice(6, 13)
+	assert.True(t, ok)
+	defer slice.Close()
+
+	assert.Equal(t, []byte("bbccccd"), slice.Bytes())
+	assert.Len(t, slice.pages, 3)
+	assert.Same(t, buffer.pages[1], slice.pages[0])
+	assert.Same(t, buffer.pages[3], slice.pages[2])
+
+	// appending to the slice must not overwrite the shared tail
+	slice.Append('1', '2', '3')
+	assert.Equal(t, []byte("bbccccd123"), slice.Bytes())
+	assert.Equal(t, []byte("aaaabbbbccccdd"), buffer.Bytes())
+	assert.Same(t, buffer.pages[2], slice.pages[1])
+
+	buffer.Append('e', 'e')
+	assert.Equal(t, []byte("aaaabbbbccccddee"), buffer.Bytes())
+	assert.Equal(t, []byte("bbccccd123"), slice.Bytes())
+
+	empty, ok := buffer.Slice(3, 3)
+	assert.True(t, ok)
+	assert.Zero(t, empty.Len())
+
+	_, ok = buffer.Slice(3, 100)
+	assert.False(t, ok)
+	_, ok = buffer.Slice(4, 3)
+	assert.False(t, ok)
+}
+
+func TestChunkedCOWBufferIO(t *testing.T) {
+	buffer := NewChunkedCOWBuffer([]byte("hello, world"), 5)
+	defer buffer.Close()
+
+	clone := buffer.Clone()
+	defer clone.Close()
+
+	written, err := clone.WriteAt([]byte("WORLD"), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, written)
+
+	written, err = clone.WriteAt([]byte("!"), 14)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, written)
+
+	_, err = clone.WriteAt([]byte("!"), -1)
+	assert.Error(t, err)
+
+	data, err := io.ReadAll(&clone)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello, WORLD\x00\x00!"), data)
+
+	data, err = io.ReadAll(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello, world"), data)
+}
+
+const benchmarkBufferSize = 4 << 20
+
+func TestChunkedCOWBufferZeroValue(t *testing.T) {
+	var buffer ChunkedCOWBuffer
+	empty, ok := buffer.Slice(0, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 0, empty.Len())
+
+	buffer.Append('a', 'b', 'c')
+	assert.Equal(t, []byte("abc"), buffer.Bytes())
+	assert.Equal(t, defaultPageSize, buffer.pageSize)
+
+	// a closed buffer can be reused
+	buffer.Close()
+	assert.Equal(t, 0, buffer.Len())
+	empty, ok = buffer.Slice(0, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 0, empty.Len())
+	buffer.Append('d')
+	assert.Equal(t, []byte("d"), buffer.Bytes())
+	buffer.Close()
+
+	// as well as a failed slice
+	failed, ok := buffer.Slice(0, 1)
+	assert.False(t, ok)
+	failed.Append('e')
+	_, err := failed.WriteAt([]byte("f"), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{'e', 0, 'f'}, failed.Bytes())
+	failed.Close()
+
+	var written ChunkedCOWBuffer
+	_, err = written.WriteAt([]byte("g"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("g"), written.Bytes())
+}
+
+func BenchmarkCOWBufferUpdate(b *testing.B) {
+	buffer := NewCOWBuffer(make([]byte, benchmarkBufferSize))
+	defer buffer.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clone := buffer.Clone()
+		clone.Update(i%benchmarkBufferSize, 'x')
+		clone.Close()
+	}
+}
+
+func BenchmarkChunkedCOWBufferUpdate(b *testing.B) {
+	buffer := NewChunkedCOWBuffer(make([]byte, benchmarkBufferSize), defaultPageSize)
+	defer buffer.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clone := buffer.Clone()
+		clone.Update(i%benchmarkBufferSize, 'x')
+		clone.Close()
+	}
+}
@@ -1,27 +1,254 @@
-// GamePerson binary layout (64 bytes):
-// [0..41]    Name (42 bytes)
-// [42..45]   X coordinate (int32, 4 bytes, big-endian)
-// [46..49]   Y coordinate (int32, 4 bytes, big-endian)
-// [50..53]   Z coordinate (int32, 4 bytes, big-endian)
-// [54..57]   Gold (int32, 4 bytes, big-endian)
-// [58..59]   Mana (10 bits: 8-bit low in byte 58, 2-bit high in bits 4-5 of byte 59)
-// [60..61]   Health (10 bits: 8-bit low in byte 60, 2-bit high in bits 4-5 of byte 61)
-// [62]       Respect (4 bits high nibble) + Strength (4 bits low nibble)
-// [63]       Experience (4 bits high nibble) + Level (4 bits low nibble)
-// [61]       also holds flags and type:
-//              bit 0 = HasHouse, bit 1 = HasGun, bit 2 = HasFamily
-//              bits 6-7 = Type (0=Builder,1=Blacksmith,2=Warrior)
+// GamePerson binary layout (64 bytes), bit offsets are counted
+// from the most significant bit of the first byte:
+// [0..335]   Name (42 bytes)
+// [336..367] X coordinate (int32, big-endian)
+// [368..399] Y coordinate (int32, big-endian)
+// [400..431] Z coordinate (int32, big-endian)
+// [432..463] Gold (int32, big-endian)
+// [464..471] Mana low 8 bits (byte 58)
+// [474..475] Mana high 2 bits (bits 4-5 of byte 59)
+// [480..487] Health low 8 bits (byte 60)
+// [488..489] Type (0=Builder,1=Blacksmith,2=Warrior, bits 6-7 of byte 61)
+// [490..491] Health high 2 bits (bits 4-5 of byte 61)
+// [493]      HasFamily (bit 2 of byte 61)
+// [494]      HasGun (bit 1 of byte 61)
+// [495]      HasHouse (bit 0 of byte 61)
+// [496..499] Respect (4 bits)
+// [500..503] Strength (4 bits)
+// [504..507] Experience (4 bits)
+// [508..511] Level (4 bits)
 
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"math"
+	"math/rand"
+	"slices"
+	"strings"
 	"testing"
+	"unicode/utf8"
 	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
 
+type Endianness int
+
+const (
+	BigEndian Endianness = iota
+	LittleEndian
+)
+
+// Field describes a value stored in Width bits starting from Offset bit,
+// fields wider than 64 bits are raw bytes, little-endian fields
+// must be aligned to bytes
+type Field struct {
+	Name   string
+	Offset int
+	Width  int
+	Signed bool
+	Order  Endianness
+}
+
+func (f Field) end() int {
+	return f.Offset + f.Width
+}
+
+func (f Field) aligned() bool {
+	return f.Offset%8 == 0 && f.Width%8 == 0
+}
+
+func (f Field) bounds() (int64, int64) {
+	switch {
+	case f.Signed:
+		return -1 << (f.Width - 1), 1<<(f.Width-1) - 1
+	case f.Width == 64:
+		return 0, math.MaxInt64
+	default:
+		return 0, 1<<f.Width - 1
+	}
+}
+
+// Layout is a validated set of fields in a record of the fixed size
+type Layout struct {
+	size   int
+	fields map[string]Field
+}
+
+func NewLayout(size int, fields ...Field) (*Layout, error) {
+	layout := &Layout{size: size, fields: make(map[string]Field, len(fields))}
+	for _, field := range fields {
+		if _, found := layout.fields[field.Name]; found {
+			return nil, fmt.Errorf("field %s is duplicated", field.Name)
+		}
+		if field.Width <= 0 || field.Offset < 0 || field.end() > size*8 {
+			return nil, fmt.Errorf("field %s is out of the record", field.Name)
+		}
+		if field.Width > 64 && (!field.aligned() || field.Signed) {
+			return nil, fmt.Errorf("field %s must be unsigned and aligned to bytes to be raw bytes", field.Name)
+		}
+		if field.Order == LittleEndian && !field.aligned() {
+			return nil, fmt.Errorf("little-endian field %s must be aligned to bytes", field.Name)
+		}
+		layout.fields[field.Name] = field
+	}
+
+	sorted := slices.Clone(fields)
+	slices.SortFunc(sorted, func(lhs, rhs Field) int {
+		return lhs.Offset - rhs.Offset
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1].end() > sorted[i].Offset {
+			return nil, fmt.Errorf("fields %s and %s overlap", sorted[i-1].Name, sorted[i].Name)
+		}
+	}
+
+	return layout, nil
+}
+
+func MustLayout(size int, fields ...Field) *Layout {
+	layout, err := NewLayout(size, fields...)
+	if err != nil {
+		panic(err)
+	}
+	return layout
+}
+
+func (l *Layout) Size() int {
+	return l.size
+}
+
+func (l *Layout) lookup(data []byte, name string) (Field, error) {
+	field, found := l.fields[name]
+	if !found {
+		return Field{}, fmt.Errorf("unknown field %s", name)
+	}
+	if len(data) < l.size {
+		return Field{}, fmt.Errorf("data is less than the layout")
+	}
+	return field, nil
+}
+
+func (l *Layout) field(data []byte, name string) Field {
+	field, err := l.lookup(data, name)
+	if err != nil {
+		panic(err)
+	}
+	return field
+}
+
+// Bounds returns the range of values that can be encoded
+func (l *Layout) Bounds(name string) (int64, int64) {
+	field, found := l.fields[name]
+	if !found || field.Width > 64 {
+		panic(fmt.Sprintf("unknown numeric field %s", name))
+	}
+	return field.bounds()
+}
+
+// Bytes returns the part of data containing a raw bytes field
+func (l *Layout) Bytes(data []byte, name string) []byte {
+	field := l.field(data, name)
+	if field.Width <= 64 && !field.aligned() {
+		panic(fmt.Sprintf("field %s isn't aligned to bytes", name))
+	}
+	return data[field.Offset/8 : field.end()/8]
+}
+
+// Field returns the declaration of the field, so hot loops
+// can encode and decode it without looking up the name
+func (l *Layout) Field(name string) (Field, bool) {
+	field, found := l.fields[name]
+	return field, found
+}
+
+func (l *Layout) Encode(data []byte, name string, value int64) error {
+	field, err := l.lookup(data, name)
+	if err != nil {
+		return err
+	}
+	if field.Width > 64 {
+		return fmt.Errorf("field %s is raw bytes", name)
+	}
+
+	if lower, upper := field.bounds(); value < lower || value > upper {
+		return fmt.Errorf("value %d of field %s is out of range [%d, %d]", value, name, lower, upper)
+	}
+
+	field.encode(data, value)
+	return nil
+}
+
+func (l *Layout) Decode(data []byte, name string) int64 {
+	field := l.field(data, name)
+	if field.Width > 64 {
+		panic(fmt.Sprintf("field %s is raw bytes", name))
+	}
+	return field.decode(data)
+}
+
+// encode expects a numeric field and a value in its bounds
+func (f Field) encode(data []byte, value int64) {
+	raw := uint64(value)
+	if f.Order == LittleEndian {
+		bytes := data[f.Offset/8 : f.end()/8]
+		for i := range bytes {
+			bytes[i] = byte(raw >> (8 * i))
+		}
+		return
+	}
+
+	position, remaining := f.Offset, f.Width
+	for remaining > 0 {
+		index, used := position/8, position%8
+		bits := min(8-used, remaining)
+		remaining -= bits
+
+		shift := 8 - used - bits
+		mask := byte((uint(1)<<bits - 1) << shift)
+		chunk := byte(raw>>remaining) << shift
+		data[index] = data[index]&^mask | chunk&mask
+		position += bits
+	}
+}
+
+// decode expects a numeric field
+func (f Field) decode(data []byte) int64 {
+	var raw uint64
+	if f.Order == LittleEndian {
+		bytes := data[f.Offset/8 : f.end()/8]
+		for i := len(bytes) - 1; i >= 0; i-- {
+			raw = raw<<8 | uint64(bytes[i])
+		}
+	} else {
+		position, remaining := f.Offset, f.Width
+		for remaining > 0 {
+			index, used := position/8, position%8
+			bits := min(8-used, remaining)
+			remaining -= bits
+
+			shift := 8 - used - bits
+			raw = raw<<bits | uint64(data[index]>>shift)&(uint64(1)<<bits-1)
+			position += bits
+		}
+	}
+
+	if f.Signed {
+		unused := 64 - f.Width
+		return int64(raw<<unused) >> unused
+	}
+	return int64(raw)
+}
+
 // Player types (2-bit):
 const (
 	BuilderGamePersonType = iota
@@ -31,120 +258,162 @@ const (
 
 // Layout sizes
 const (
-	NameMaxLength = 42 // bytes allocated for name
+	NameMaxLength     = 42            // bytes allocated for name
+	NameMaxCharacters = NameMaxLength // characters allowed in name
 )
 
-// Byte offsets within data buffer
-const (
-	dX          = NameMaxLength // 42: X coordinate (int32)
-	dY          = dX + 4        // 46: Y coordinate (int32)
-	dZ          = dY + 4        // 50: Z coordinate (int32)
-	dGold       = dZ + 4        // 54: Gold (int32)
-	dMana       = dGold + 4     // 58: Mana (10‑bit)
-	dHealth     = dMana + 2     // 60: Health (10‑bit)
-	dRespect    = dHealth + 2   // 62: Respect/Strength (4+4 bits)
-	dExperience = dRespect + 1  // 63: Experience/Level (4+4 bits)
+var personLayout = MustLayout(64,
+	Field{Name: "Name", Offset: 0, Width: NameMaxLength * 8},
+	Field{Name: "X", Offset: 336, Width: 32, Signed: true},
+	Field{Name: "Y", Offset: 368, Width: 32, Signed: true},
+	Field{Name: "Z", Offset: 400, Width: 32, Signed: true},
+	Field{Name: "Gold", Offset: 432, Width: 32, Signed: true},
+	Field{Name: "ManaLow", Offset: 464, Width: 8},
+	Field{Name: "ManaHigh", Offset: 474, Width: 2},
+	Field{Name: "HealthLow", Offset: 480, Width: 8},
+	Field{Name: "Type", Offset: 488, Width: 2},
+	Field{Name: "HealthHigh", Offset: 490, Width: 2},
+	Field{Name: "HasFamily", Offset: 493, Width: 1},
+	Field{Name: "HasGun", Offset: 494, Width: 1},
+	Field{Name: "HasHouse", Offset: 495, Width: 1},
+	Field{Name: "Respect", Offset: 496, Width: 4},
+	Field{Name: "Strength", Offset: 500, Width: 4},
+	Field{Name: "Experience", Offset: 504, Width: 4},
+	Field{Name: "Level", Offset: 508, Width: 4},
 )
 
-// Flags and type packed into bits of byte at flagsOffset
-const (
-	flagsOffset = dHealth + 1 // 61: shared with high 2 bits of Health
+// splitField is a value stored in two fields to keep the original
+// format, where the low byte is followed by the high bits elsewhere
+type splitField struct {
+	low  Field
+	high Field
+}
 
-	flagHouseBit  = 0 // bit 0: HasHouse
-	flagGunBit    = 1 // bit 1: HasGun
-	flagFamilyBit = 2 // bit 2: HasFamily
+func newSplitField(low, high string) splitField {
+	lowField, lowFound := personLayout.Field(low)
+	highField, highFound := personLayout.Field(high)
+	if !lowFound || !highFound {
+		panic(fmt.Sprintf("unknown fields %s and %s", low, high))
+	}
+	return splitField{low: lowField, high: highField}
+}
 
-	typeShift = 6 // bits 6-7: player type
-	typeMask  = 0x03 << typeShift
-)
+func (f splitField) bounds() (int64, int64) {
+	return 0, 1<<(f.low.Width+f.high.Width) - 1
+}
 
-type Option func(*GamePerson)
+// encode expects a value in the bounds
+func (f splitField) encode(data []byte, value int64) {
+	f.low.encode(data, value&(1<<f.low.Width-1))
+	f.high.encode(data, value>>f.low.Width)
+}
 
-func WithName(name string) func(*GamePerson) {
-	return func(person *GamePerson) {
-		if len(name) > NameMaxLength {
-			panic("NameMaxLength exeeded")
-		}
-		copy(person.data[:], name)
+func (f splitField) decode(data []byte) int64 {
+	return f.high.decode(data)<<f.low.Width | f.low.decode(data)
+}
+
+var personSplitFields = map[string]splitField{
+	"Mana":   newSplitField("ManaLow", "ManaHigh"),
+	"Health": newSplitField("HealthLow", "HealthHigh"),
+}
+
+// ValidationError describes a value that doesn't fit into its field
+type ValidationError struct {
+	Field  string
+	Value  any
+	Min    int64
+	Max    int64
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	message := fmt.Sprintf("invalid %s %v: allowed range is [%d, %d]", e.Field, e.Value, e.Min, e.Max)
+	if e.Reason != "" {
+		message += ", " + e.Reason
 	}
+	return message
 }
 
-func WithCoordinates(x, y, z int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.writeInt32Raw(dX, x)
-		person.writeInt32Raw(dY, y)
-		person.writeInt32Raw(dZ, z)
+type Option func(*GamePerson) error
+
+func WithName(name string) Option {
+	return func(person *GamePerson) error {
+		return person.SetName(name)
 	}
 }
 
-func WithGold(gold int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.writeInt32Raw(dGold, gold)
+func WithCoordinates(x, y, z int) Option {
+	return func(person *GamePerson) error {
+		return person.SetCoordinates(x, y, z)
 	}
 }
 
-func WithMana(mana int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.write10bitValue(dMana, mana)
+func WithGold(gold int) Option {
+	return func(person *GamePerson) error {
+		return person.SetGold(gold)
 	}
 }
 
-func WithHealth(health int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.write10bitValue(dHealth, health)
+func WithMana(mana int) Option {
+	return func(person *GamePerson) error {
+		return person.SetMana(mana)
 	}
 }
 
-func WithRespect(respect int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.write4bitValue(dRespect, respect, true)
+func WithHealth(health int) Option {
+	return func(person *GamePerson) error {
+		return person.SetHealth(health)
 	}
 }
 
-func WithStrength(strength int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.write4bitValue(dRespect, strength, false)
+func WithRespect(respect int) Option {
+	return func(person *GamePerson) error {
+		return person.SetRespect(respect)
 	}
 }
 
-func WithExperience(experience int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.write4bitValue(dExperience, experience, true)
+func WithStrength(strength int) Option {
+	return func(person *GamePerson) error {
+		return person.SetStrength(strength)
 	}
 }
 
-func WithLevel(level int) func(*GamePerson) {
-	return func(person *GamePerson) {
-		person.write4bitValue(dExperience, level, false)
+func WithExperience(experience int) Option {
+	return func(person *GamePerson) error {
+		return person.SetExperience(experience)
 	}
 }
 
-func WithHouse() func(*GamePerson) {
-	return func(p *GamePerson) {
-		p.data[flagsOffset] |= 1 << flagHouseBit
+func WithLevel(level int) Option {
+	return func(person *GamePerson) error {
+		return person.SetLevel(level)
 	}
 }
 
-func WithGun() func(*GamePerson) {
-	return func(p *GamePerson) {
-		p.data[flagsOffset] |= 1 << flagGunBit
+func WithHouse() Option {
+	return func(person *GamePerson) error {
+		person.SetHouse(true)
+		return nil
 	}
 }
 
-func WithFamily() func(*GamePerson) {
-	return func(p *GamePerson) {
-		p.data[flagsOffset] |= 1 << flagFamilyBit
+func WithGun() Option {
+	return func(person *GamePerson) error {
+		person.SetGun(true)
+		return nil
 	}
 }
 
-func WithType(personType int) func(*GamePerson) {
-	return func(p *GamePerson) {
-		if personType < BuilderGamePersonType || personType > WarriorGamePersonType {
-			panic("invalid person type")
-		}
+func WithFamily() Option {
+	return func(person *GamePerson) error {
+		person.SetFamily(true)
+		return nil
+	}
+}
 
-		p.data[flagsOffset] &^= typeMask
-		p.data[flagsOffset] |= byte(personType) << typeShift
+func WithType(personType int) Option {
+	return func(person *GamePerson) error {
+		return person.SetType(personType)
 	}
 }
 
@@ -152,138 +421,496 @@ type GamePerson struct {
 	data [64]byte
 }
 
+// NewGamePerson panics on invalid options, NewGamePersonE
+// should be used for values from users
 func NewGamePerson(options ...Option) GamePerson {
+	person, err := NewGamePersonE(options...)
+	if err != nil {
+		panic(err)
+	}
+	return person
+}
+
+// NewGamePersonE applies all options and returns all validation
+// errors joined, every error is *ValidationError
+func NewGamePersonE(options ...Option) (GamePerson, error) {
 	person := GamePerson{}
 
+	var errs []error
 	for _, option := range options {
-		option(&person)
+		if err := option(&person); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	return person
+	if err := errors.Join(errs...); err != nil {
+		return GamePerson{}, err
+	}
+	return person, nil
+}
+
+func personBounds(name string) (int64, int64) {
+	if field, found := personSplitFields[name]; found {
+		return field.bounds()
+	}
+	return personLayout.Bounds(name)
+}
+
+func (p *GamePerson) validate(name string, value int) error {
+	lower, upper := personBounds(name)
+	if int64(value) < lower || int64(value) > upper {
+		return &ValidationError{Field: name, Value: value, Min: lower, Max: upper}
+	}
+	return nil
+}
+
+// set expects a validated value
+func (p *GamePerson) set(name string, value int) {
+	if field, found := personSplitFields[name]; found {
+		field.encode(p.data[:], int64(value))
+		return
+	}
+	if err := personLayout.Encode(p.data[:], name, int64(value)); err != nil {
+		panic(err)
+	}
+}
+
+func (p *GamePerson) setChecked(name string, value int) error {
+	if err := p.validate(name, value); err != nil {
+		return err
+	}
+	p.set(name, value)
+	return nil
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// SetName limits the name by NameMaxCharacters characters, a name
+// is stored in UTF-8, so a name with non-ASCII characters must also
+// fit into NameMaxLength bytes of the record
+func (p *GamePerson) SetName(name string) error {
+	if !utf8.ValidString(name) || strings.IndexByte(name, 0) >= 0 {
+		return &ValidationError{Field: "Name", Value: name, Max: NameMaxCharacters, Reason: "name must be valid UTF-8 without zero bytes"}
+	}
+
+	characters := utf8.RuneCountInString(name)
+	if characters > NameMaxCharacters {
+		reason := fmt.Sprintf("%d characters are too many", characters)
+		return &ValidationError{Field: "Name", Value: name, Max: NameMaxCharacters, Reason: reason}
+	}
+	if len(name) > NameMaxLength {
+		reason := fmt.Sprintf("%d characters take %d bytes, but only %d bytes fit into the record", characters, len(name), NameMaxLength)
+		return &ValidationError{Field: "Name", Value: name, Max: NameMaxCharacters, Reason: reason}
+	}
+
+	data := personLayout.Bytes(p.data[:], "Name")
+	clear(data[copy(data, name):])
+	return nil
+}
+
+// SetCoordinates doesn't change any coordinate if one of them is invalid
+func (p *GamePerson) SetCoordinates(x, y, z int) error {
+	err := errors.Join(p.validate("X", x), p.validate("Y", y), p.validate("Z", z))
+	if err != nil {
+		return err
+	}
+
+	p.set("X", x)
+	p.set("Y", y)
+	p.set("Z", z)
+	return nil
+}
+
+func (p *GamePerson) SetGold(gold int) error {
+	return p.setChecked("Gold", gold)
+}
+
+func (p *GamePerson) SetMana(mana int) error {
+	return p.setChecked("Mana", mana)
+}
+
+func (p *GamePerson) SetHealth(health int) error {
+	return p.setChecked("Health", health)
+}
+
+func (p *GamePerson) SetRespect(respect int) error {
+	return p.setChecked("Respect", respect)
+}
+
+func (p *GamePerson) SetStrength(strength int) error {
+	return p.setChecked("Strength", strength)
+}
+
+func (p *GamePerson) SetExperience(experience int) error {
+	return p.setChecked("Experience", experience)
+}
+
+func (p *GamePerson) SetLevel(level int) error {
+	return p.setChecked("Level", level)
+}
+
+func (p *GamePerson) SetHouse(hasHouse bool) {
+	p.set("HasHouse", boolToInt(hasHouse))
+}
+
+func (p *GamePerson) SetGun(hasGun bool) {
+	p.set("HasGun", boolToInt(hasGun))
+}
+
+func (p *GamePerson) SetFamily(hasFamily bool) {
+	p.set("HasFamily", boolToInt(hasFamily))
+}
+
+func (p *GamePerson) SetType(personType int) error {
+	if personType < BuilderGamePersonType || personType > WarriorGamePersonType {
+		return &ValidationError{Field: "Type", Value: personType, Min: BuilderGamePersonType, Max: WarriorGamePersonType}
+	}
+	p.set("Type", personType)
+	return nil
+}
+
+func (p *GamePerson) get(name string) int {
+	if field, found := personSplitFields[name]; found {
+		return int(field.decode(p.data[:]))
+	}
+	return int(personLayout.Decode(p.data[:], name))
 }
 
 func (p *GamePerson) Name() string {
+	name := personLayout.Bytes(p.data[:], "Name")
 	var nameLength int
-	for i := range NameMaxLength {
-		if p.data[i] == 0 {
-			break
-		}
+	for nameLength < len(name) && name[nameLength] != 0 {
 		nameLength++
 	}
-	return unsafe.String(&p.data[0], nameLength)
+	return unsafe.String(unsafe.SliceData(name), nameLength)
 }
 
 func (p *GamePerson) X() int {
-	return int(p.readInt32Raw(dX))
+	return p.get("X")
 }
 
 func (p *GamePerson) Y() int {
-	return int(p.readInt32Raw(dY))
+	return p.get("Y")
 }
 
 func (p *GamePerson) Z() int {
-	return int(p.readInt32Raw(dZ))
+	return p.get("Z")
 }
 
 func (p *GamePerson) Gold() int {
-	return int(p.readInt32Raw(dGold))
+	return p.get("Gold")
 }
 
 func (p *GamePerson) Mana() int {
-	return p.read10bitValue(dMana)
+	return p.get("Mana")
 }
 
 func (p *GamePerson) Health() int {
-	return p.read10bitValue(dHealth)
+	return p.get("Health")
 }
 
 func (p *GamePerson) Respect() int {
-	return p.read4bitValue(dRespect, true)
+	return p.get("Respect")
 }
 
 func (p *GamePerson) Strength() int {
-	return p.read4bitValue(dRespect, false)
+	return p.get("Strength")
 }
 
 func (p *GamePerson) Experience() int {
-	return p.read4bitValue(dExperience, true)
+	return p.get("Experience")
 }
 
 func (p *GamePerson) Level() int {
-	return p.read4bitValue(dExperience, false)
+	return p.get("Level")
 }
 
 func (p *GamePerson) HasHouse() bool {
-	return (p.data[flagsOffset]>>flagHouseBit)&1 != 0
+	return p.get("HasHouse") != 0
 }
 
 func (p *GamePerson) HasGun() bool {
-	return (p.data[flagsOffset]>>flagGunBit)&1 != 0
+	return p.get("HasGun") != 0
 }
 
 func (p *GamePerson) HasFamilty() bool {
-	return (p.data[flagsOffset]>>flagFamilyBit)&1 != 0
+	return p.get("HasFamily") != 0
 }
 
 func (p *GamePerson) Type() int {
-	return int((p.data[flagsOffset] & typeMask) >> typeShift)
+	return p.get("Type")
 }
 
-func (p *GamePerson) writeInt32Raw(offset int, value int) {
-	if offset+4 > len(p.data) {
-		panic("offset out of range")
+type StoreLayout int
+
+const (
+	PackedStoreLayout   StoreLayout = iota // []GamePerson with 64-byte records
+	ColumnarStoreLayout                    // struct of arrays with decoded values
+)
+
+const AnyGamePersonType = -1
+
+type BoundingBox struct {
+	MinX, MinY, MinZ int
+	MaxX, MaxY, MaxZ int
+}
+
+func (b BoundingBox) contains(x, y, z int) bool {
+	return x >= b.MinX && x <= b.MaxX &&
+		y >= b.MinY && y <= b.MaxY &&
+		z >= b.MinZ && z <= b.MaxZ
+}
+
+type PersonQuery struct {
+	Type      int // AnyGamePersonType matches all types
+	GoldAbove int
+	Box       BoundingBox
+}
+
+// personFields are resolved once for hot loops over packed records
+var personFields = func() map[string]Field {
+	fields := make(map[string]Field)
+	for _, name := range []string{"X", "Y", "Z", "Gold", "Respect", "Strength",
+		"Experience", "Level", "HasHouse", "HasGun", "HasFamily", "Type"} {
+		fields[name], _ = personLayout.Field(name)
 	}
-	if value < math.MinInt32 || value > math.MaxInt32 {
-		panic("value out of int32 range")
+	return fields
+}()
+
+type personColumns struct {
+	names      [][NameMaxLength]byte
+	x, y, z    []int32
+	gold       []int32
+	mana       []uint16
+	health     []uint16
+	respect    []uint8
+	strength   []uint8
+	experience []uint8
+	level      []uint8
+	flags      []uint8 // bit 0 = HasHouse, bit 1 = HasGun, bit 2 = HasFamily
+	types      []uint8
+}
+
+type GamePersonStore struct {
+	layout  StoreLayout
+	records []GamePerson
+	columns personColumns
+}
+
+func NewGamePersonStore(layout StoreLayout) *GamePersonStore {
+	if layout != PackedStoreLayout && layout != ColumnarStoreLayout {
+		panic("invalid store layout")
 	}
-	p.data[offset] = byte(value >> 24)
-	p.data[offset+1] = byte(value >> 16)
-	p.data[offset+2] = byte(value >> 8)
-	p.data[offset+3] = byte(value)
+	return &GamePersonStore{layout: layout}
 }
 
-func (p *GamePerson) readInt32Raw(offset int) int32 {
-	if offset+4 > len(p.data) {
-		panic("offset out of range")
+func (s *GamePersonStore) Len() int {
+	if s.layout == PackedStoreLayout {
+		return len(s.records)
 	}
-	value := int32(p.data[offset])<<24 |
-		int32(p.data[offset+1])<<16 |
-		int32(p.data[offset+2])<<8 |
-		int32(p.data[offset+3])
-	return value
+	return len(s.columns.types)
 }
 
-func (p *GamePerson) write10bitValue(offset, value int) {
-	if value < 0 || value > 0x3FF {
-		panic("value out of 10-bit range")
+func (s *GamePersonStore) Add(person GamePerson) {
+	if s.layout == PackedStoreLayout {
+		s.records = append(s.records, person)
+		return
 	}
-	p.data[offset] = byte(value & 0xFF)
-	p.data[offset+1] = (p.data[offset+1] & 0x0F) | byte((value>>8)&0x03)<<4
+
+	c := &s.columns
+	c.names = append(c.names, [NameMaxLength]byte(personLayout.Bytes(person.data[:], "Name")))
+	c.x = append(c.x, int32(person.X()))
+	c.y = append(c.y, int32(person.Y()))
+	c.z = append(c.z, int32(person.Z()))
+	c.gold = append(c.gold, int32(person.Gold()))
+	c.mana = append(c.mana, uint16(person.Mana()))
+	c.health = append(c.health, uint16(person.Health()))
+	c.respect = append(c.respect, uint8(person.Respect()))
+	c.strength = append(c.strength, uint8(person.Strength()))
+	c.experience = append(c.experience, uint8(person.Experience()))
+	c.level = append(c.level, uint8(person.Level()))
+	c.flags = append(c.flags, uint8(boolToInt(person.HasHouse())|boolToInt(person.HasGun())<<1|boolToInt(person.HasFamilty())<<2))
+	c.types = append(c.types, uint8(person.Type()))
 }
 
-func (p *GamePerson) read10bitValue(offset int) int {
-	low := int(p.data[offset])
-	high := int((p.data[offset+1] >> 4) & 0x03)
-	return (high << 8) | low
+func (s *GamePersonStore) Get(index int) GamePerson {
+	if s.layout == PackedStoreLayout {
+		return s.records[index]
+	}
+
+	c := &s.columns
+	var person GamePerson
+	copy(personLayout.Bytes(person.data[:], "Name"), c.names[index][:])
+
+	set := func(name string, value int64) {
+		personFields[name].encode(person.data[:], value)
+	}
+	set("X", int64(c.x[index]))
+	set("Y", int64(c.y[index]))
+	set("Z", int64(c.z[index]))
+	set("Gold", int64(c.gold[index]))
+	personSplitFields["Mana"].encode(person.data[:], int64(c.mana[index]))
+	personSplitFields["Health"].encode(person.data[:], int64(c.health[index]))
+	set("Respect", int64(c.respect[index]))
+	set("Strength", int64(c.strength[index]))
+	set("Experience", int64(c.experience[index]))
+	set("Level", int64(c.level[index]))
+	set("HasHouse", int64(c.flags[index]&1))
+	set("HasGun", int64(c.flags[index]>>1&1))
+	set("HasFamily", int64(c.flags[index]>>2&1))
+	set("Type", int64(c.types[index]))
+	return person
 }
 
-func (p *GamePerson) write4bitValue(offset, value int, highNibble bool) {
-	if value < 0 || value > 0xF {
-		panic("value out of 4-bit range")
+// Find returns indexes of persons matched by the query
+func (s *GamePersonStore) Find(query PersonQuery) []int {
+	var indexes []int
+	if s.layout == PackedStoreLayout {
+		x, y, z := personFields["X"], personFields["Y"], personFields["Z"]
+		gold, personType := personFields["Gold"], personFields["Type"]
+
+		for i := range s.records {
+			data := s.records[i].data[:]
+			if query.Type != AnyGamePersonType && int(personType.decode(data)) != query.Type {
+				continue
+			}
+			if int(gold.decode(data)) <= query.GoldAbove {
+				continue
+			}
+			if query.Box.contains(int(x.decode(data)), int(y.decode(data)), int(z.decode(data))) {
+				indexes = append(indexes, i)
+			}
+		}
+		return indexes
 	}
 
-	if highNibble {
-		p.data[offset] = (p.data[offset] & 0x0F) | byte(value<<4)
-	} else {
-		p.data[offset] = (p.data[offset] & 0xF0) | byte(value&0x0F)
+	c := &s.columns
+	for i, personType := range c.types {
+		if query.Type != AnyGamePersonType && int(personType) != query.Type {
+			continue
+		}
+		if int(c.gold[i]) <= query.GoldAbove {
+			continue
+		}
+		if query.Box.contains(int(c.x[i]), int(c.y[i]), int(c.z[i])) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Store file format (little-endian):
+// [0..3]   magic "GPST"
+// [4..5]   version
+// [6..7]   record size
+// [8..15]  records number
+// [16..]   packed records
+// [last 4] CRC-32 (IEEE) of everything above
+const (
+	storeMagic      = "GPST"
+	storeVersion    = 1
+	storeHeaderSize = 16
+)
+
+var (
+	ErrInvalidStoreFile   = errors.New("invalid store file")
+	ErrUnsupportedVersion = errors.New("unsupported store file version")
+	ErrChecksumMismatch   = errors.New("store file checksum mismatch")
+)
+
+func (s *GamePersonStore) WriteTo(writer io.Writer) (int64, error) {
+	hash := crc32.NewIEEE()
+	counter := &countingWriter{writer: io.MultiWriter(writer, hash)}
+	buffered := bufio.NewWriter(counter)
+
+	header := make([]byte, storeHeaderSize)
+	copy(header, storeMagic)
+	binary.LittleEndian.PutUint16(header[4:], storeVersion)
+	binary.LittleEndian.PutUint16(header[6:], uint16(personLayout.Size()))
+	binary.LittleEndian.PutUint64(header[8:], uint64(s.Len()))
+	_, _ = buffered.Write(header)
+
+	for i := 0; i < s.Len(); i++ {
+		person := s.Get(i)
+		_, _ = buffered.Write(person.data[:])
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return counter.written, err
 	}
+
+	written, err := writer.Write(binary.LittleEndian.AppendUint32(nil, hash.Sum32()))
+	return counter.written + int64(written), err
 }
 
-func (p *GamePerson) read4bitValue(offset int, highNibble bool) int {
-	if highNibble {
-		return int(p.data[offset] >> 4)
+// ReadFrom replaces the content of the store keeping its layout,
+// it doesn't buffer the reader and stops right after the checksum
+func (s *GamePersonStore) ReadFrom(reader io.Reader) (int64, error) {
+	hash := crc32.NewIEEE()
+	counter := &countingReader{reader: reader}
+	hashed := io.TeeReader(counter, hash)
+
+	header := make([]byte, storeHeaderSize)
+	if _, err := io.ReadFull(hashed, header); err != nil {
+		return counter.read, fmt.Errorf("%w: %w", ErrInvalidStoreFile, err)
+	}
+	if string(header[:4]) != storeMagic {
+		return counter.read, fmt.Errorf("%w: unknown magic %q", ErrInvalidStoreFile, header[:4])
+	}
+	if version := binary.LittleEndian.Uint16(header[4:]); version != storeVersion {
+		return counter.read, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	if size := binary.LittleEndian.Uint16(header[6:]); int(size) != personLayout.Size() {
+		return counter.read, fmt.Errorf("%w: record size %d", ErrInvalidStoreFile, size)
+	}
+
+	loaded := NewGamePersonStore(s.layout)
+	count := binary.LittleEndian.Uint64(header[8:])
+	for i := uint64(0); i < count; i++ {
+		var person GamePerson
+		if _, err := io.ReadFull(hashed, person.data[:]); err != nil {
+			return counter.read, fmt.Errorf("%w: %w", ErrInvalidStoreFile, err)
+		}
+		loaded.Add(person)
+	}
+
+	checksum := make([]byte, 4)
+	if _, err := io.ReadFull(counter, checksum); err != nil {
+		return counter.read, fmt.Errorf("%w: %w", ErrInvalidStoreFile, err)
+	}
+	if binary.LittleEndian.Uint32(checksum) != hash.Sum32() {
+		return counter.read, ErrChecksumMismatch
 	}
-	return int(p.data[offset] & 0x0F)
+
+	*s = *loaded
+	return counter.read, nil
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	written, err := w.writer.Write(data)
+	w.written += int64(written)
+	return written, err
+}
+
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countingReader) Read(data []byte) (int, error) {
+	read, err := r.reader.Read(data)
+	r.read += int64(read)
+	return read, err
 }
 
 func TestGamePerson(t *testing.T) {
@@ -332,3 +959,357 @@ func TestGamePerson(t *testing.T) {
 	assert.False(t, person.HasGun())
 	assert.Equal(t, personType, person.Type())
 }
+
+// the format of records is pinned, any change of the layout
+// breaks stored records and must be done deliberately
+func TestGamePersonGoldenBytes(t *testing.T) {
+	person := NewGamePerson(
+		WithName("Ab"),
+		WithCoordinates(-2, 0x01020304, 7),
+		WithGold(1000),
+		WithMana(1000),
+		WithHealth(515),
+		WithRespect(10),
+		WithStrength(5),
+		WithExperience(3),
+		WithLevel(12),
+		WithHouse(),
+		WithFamily(),
+		WithType(WarriorGamePersonType),
+	)
+
+	expected := make([]byte, 40, 64)
+	expected[0], expected[1] = 'A', 'b'
+	expected = append(expected, mustDecodeHex("0000fffffffe0102030400000007000003e8e83003a5a53c")...)
+	assert.Equal(t, expected, person.data[:])
+
+	other := NewGamePerson(WithGun(), WithMana(1023), WithType(BlacksmithGamePersonType))
+	assert.Equal(t, mustDecodeHex("0000ff3000420000"), other.data[56:])
+
+	decoded := GamePerson{data: [64]byte(expected)}
+	assert.Equal(t, "Ab", decoded.Name())
+	assert.Equal(t, 1000, decoded.Mana())
+	assert.Equal(t, 515, decoded.Health())
+	assert.Equal(t, WarriorGamePersonType, decoded.Type())
+	assert.True(t, decoded.HasHouse())
+	assert.False(t, decoded.HasGun())
+	assert.True(t, decoded.HasFamilty())
+}
+
+func mustDecodeHex(data string) []byte {
+	decoded, err := hex.DecodeString(data)
+	if err != nil {
+		panic(err)
+	}
+	return decoded
+}
+
+func TestLayoutValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []Field
+	}{
+		{"overlap", []Field{{Name: "a", Offset: 0, Width: 10}, {Name: "b", Offset: 9, Width: 2}}},
+		{"duplicate", []Field{{Name: "a", Offset: 0, Width: 1}, {Name: "a", Offset: 1, Width: 1}}},
+		{"out of record", []Field{{Name: "a", Offset: 125, Width: 5}}},
+		{"negative offset", []Field{{Name: "a", Offset: -1, Width: 1}}},
+		{"zero width", []Field{{Name: "a", Offset: 0, Width: 0}}},
+		{"unaligned little-endian", []Field{{Name: "a", Offset: 4, Width: 16, Order: LittleEndian}}},
+		{"unaligned bytes", []Field{{Name: "a", Offset: 4, Width: 8 * 9}}},
+		{"signed bytes", []Field{{Name: "a", Offset: 0, Width: 8 * 9, Signed: true}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewLayout(16, test.fields...)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewLayout(8, Field{Name: "a", Offset: 10, Width: 2}, Field{Name: "b", Offset: 0, Width: 10})
+	assert.NoError(t, err)
+	assert.Panics(t, func() {
+		MustLayout(1, Field{Name: "a", Offset: 0, Width: 9})
+	})
+}
+
+func TestLayoutEncoding(t *testing.T) {
+	layout := MustLayout(12,
+		Field{Name: "flag", Offset: 0, Width: 1},
+		Field{Name: "small", Offset: 1, Width: 5, Signed: true},
+		Field{Name: "wide", Offset: 6, Width: 12},
+		Field{Name: "big", Offset: 24, Width: 32, Signed: true},
+		Field{Name: "little", Offset: 56, Width: 32, Signed: true, Order: LittleEndian},
+	)
+
+	data := make([]byte, layout.Size())
+	assert.NoError(t, layout.Encode(data, "flag", 1))
+	assert.NoError(t, layout.Encode(data, "small", -16))
+	assert.NoError(t, layout.Encode(data, "wide", 0xABC))
+	assert.NoError(t, layout.Encode(data, "big", -2))
+	assert.NoError(t, layout.Encode(data, "little", 0x01020304))
+
+	assert.Equal(t, int64(1), layout.Decode(data, "flag"))
+	assert.Equal(t, int64(-16), layout.Decode(data, "small"))
+	assert.Equal(t, int64(0xABC), layout.Decode(data, "wide"))
+	assert.Equal(t, int64(-2), layout.Decode(data, "big"))
+	assert.Equal(t, int64(0x01020304), layout.Decode(data, "little"))
+
+	// 1 | 10000 | 10 1010 1111 00 (fields are packed from the most significant bit)
+	assert.Equal(t, []byte{0xC2, 0xAF, 0x00}, data[:3])
+	assert.Equal(t, uint32(0xFFFFFFFE), binary.BigEndian.Uint32(data[3:7]))
+	assert.Equal(t, []byte{0x04, 0x03, 0x02, 0x01}, data[7:11])
+
+	assert.Error(t, layout.Encode(data, "small", 16))
+	assert.Error(t, layout.Encode(data, "small", -17))
+	assert.Error(t, layout.Encode(data, "wide", -1))
+	assert.Error(t, layout.Encode(data, "wide", 1<<12))
+	assert.Error(t, layout.Encode(data, "unknown", 0))
+	assert.Equal(t, int64(-16), layout.Decode(data, "small"))
+
+	lower, upper := layout.Bounds("small")
+	assert.Equal(t, int64(-16), lower)
+	assert.Equal(t, int64(15), upper)
+}
+
+func TestGamePersonValidation(t *testing.T) {
+	person, err := NewGamePersonE(
+		WithName(strings.Repeat("й", 22)),
+		WithCoordinates(1, math.MaxInt32+1, math.MinInt32-1),
+		WithMana(1024),
+		WithHealth(-1),
+		WithRespect(10),
+		WithType(3),
+	)
+	assert.Error(t, err)
+	assert.Equal(t, GamePerson{}, person)
+
+	var validationErrs []*ValidationError
+	var unwrap func(err error)
+	unwrap = func(err error) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				unwrap(err)
+			}
+			return
+		}
+
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		validationErrs = append(validationErrs, validationErr)
+	}
+	unwrap(err)
+
+	assert.Equal(t, []*ValidationError{
+		{Field: "Name", Value: strings.Repeat("й", 22), Max: NameMaxCharacters, Reason: "22 characters take 44 bytes, but only 42 bytes fit into the record"},
+		{Field: "Y", Value: math.MaxInt32 + 1, Min: math.MinInt32, Max: math.MaxInt32},
+		{Field: "Z", Value: math.MinInt32 - 1, Min: math.MinInt32, Max: math.MaxInt32},
+		{Field: "Mana", Value: 1024, Min: 0, Max: 1023},
+		{Field: "Health", Value: -1, Min: 0, Max: 1023},
+		{Field: "Type", Value: 3, Min: BuilderGamePersonType, Max: WarriorGamePersonType},
+	}, validationErrs)
+	assert.ErrorContains(t, err, "invalid Mana 1024: allowed range is [0, 1023]")
+
+	_, err = NewGamePersonE(WithName("invalid \xff"))
+	assert.ErrorContains(t, err, "valid UTF-8")
+
+	assert.Panics(t, func() {
+		NewGamePerson(WithMana(1024))
+	})
+}
+
+func TestGamePersonNameLength(t *testing.T) {
+	var person GamePerson
+
+	// characters are counted, not bytes
+	assert.NoError(t, person.SetName(strings.Repeat("a", NameMaxCharacters)))
+	assert.NoError(t, person.SetName(strings.Repeat("й", 21)))
+	assert.Equal(t, strings.Repeat("й", 21), person.Name())
+	assert.NoError(t, person.SetName("Пётр Великий"))
+	assert.Equal(t, "Пётр Великий", person.Name())
+
+	err := person.SetName(strings.Repeat("a", NameMaxCharacters+1))
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "43 characters are too many", validationErr.Reason)
+	assert.Equal(t, int64(NameMaxCharacters), validationErr.Max)
+
+	err = person.SetName(strings.Repeat("й", NameMaxCharacters+1))
+	assert.ErrorContains(t, err, "43 characters are too many")
+
+	// the name is left unchanged on errors
+	assert.Equal(t, "Пётр Великий", person.Name())
+}
+
+func TestGamePersonSetters(t *testing.T) {
+	person, err := NewGamePersonE(WithName("Пётр Великий"), WithCoordinates(1, 2, 3), WithMana(10), WithGun())
+	assert.NoError(t, err)
+	assert.Equal(t, "Пётр Великий", person.Name())
+
+	assert.NoError(t, person.SetName("Ivan"))
+	assert.Equal(t, "Ivan", person.Name())
+
+	assert.Error(t, person.SetCoordinates(10, 20, math.MaxInt32+1))
+	assert.Equal(t, []int{1, 2, 3}, []int{person.X(), person.Y(), person.Z()})
+
+	assert.Error(t, person.SetMana(-5))
+	assert.Equal(t, 10, person.Mana())
+	assert.NoError(t, person.SetMana(1023))
+	assert.Equal(t, 1023, person.Mana())
+
+	person.SetGun(false)
+	person.SetFamily(true)
+	assert.False(t, person.HasGun())
+	assert.True(t, person.HasFamilty())
+
+	assert.Error(t, person.SetType(-1))
+	assert.NoError(t, person.SetType(WarriorGamePersonType))
+	assert.Equal(t, WarriorGamePersonType, person.Type())
+	assert.Equal(t, 1023, person.Mana())
+}
+
+func randomPerson(random *rand.Rand) GamePerson {
+	return NewGamePerson(
+		WithName(fmt.Sprintf("person-%d", random.Intn(1000))),
+		WithCoordinates(random.Intn(2000)-1000, random.Intn(2000)-1000, random.Intn(2000)-1000),
+		WithGold(random.Intn(10000)),
+		WithMana(random.Intn(1024)),
+		WithHealth(random.Intn(1024)),
+		WithRespect(random.Intn(16)),
+		WithStrength(random.Intn(16)),
+		WithExperience(random.Intn(16)),
+		WithLevel(random.Intn(16)),
+		WithType(random.Intn(3)),
+		func(person *GamePerson) error {
+			person.SetHouse(random.Intn(2) == 0)
+			person.SetGun(random.Intn(2) == 0)
+			person.SetFamily(random.Intn(2) == 0)
+			return nil
+		},
+	)
+}
+
+func TestGamePersonStore(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	packed := NewGamePersonStore(PackedStoreLayout)
+	columnar := NewGamePersonStore(ColumnarStoreLayout)
+
+	var persons []GamePerson
+	for i := 0; i < 1000; i++ {
+		person := randomPerson(random)
+		persons = append(persons, person)
+		packed.Add(person)
+		columnar.Add(person)
+	}
+
+	assert.Equal(t, len(persons), packed.Len())
+	assert.Equal(t, len(persons), columnar.Len())
+	for i, person := range persons {
+		assert.Equal(t, person, packed.Get(i))
+		assert.Equal(t, person, columnar.Get(i))
+	}
+
+	query := PersonQuery{
+		Type:      WarriorGamePersonType,
+		GoldAbove: 5000,
+		Box:       BoundingBox{MinX: -500, MinY: -500, MinZ: -500, MaxX: 500, MaxY: 500, MaxZ: 500},
+	}
+
+	var expected []int
+	for i, person := range persons {
+		if person.Type() == WarriorGamePersonType && person.Gold() > 5000 &&
+			query.Box.contains(person.X(), person.Y(), person.Z()) {
+			expected = append(expected, i)
+		}
+	}
+
+	assert.NotEmpty(t, expected)
+	assert.Equal(t, expected, packed.Find(query))
+	assert.Equal(t, expected, columnar.Find(query))
+
+	query.Type = AnyGamePersonType
+	assert.Greater(t, len(packed.Find(query)), len(expected))
+	assert.Equal(t, packed.Find(query), columnar.Find(query))
+}
+
+func TestGamePersonStoreSerialization(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	columnar := NewGamePersonStore(ColumnarStoreLayout)
+	for i := 0; i < 100; i++ {
+		columnar.Add(randomPerson(random))
+	}
+
+	var file bytes.Buffer
+	written, err := columnar.WriteTo(&file)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(storeHeaderSize+100*64+4), written)
+	assert.Equal(t, int64(file.Len()), written)
+
+	packed := NewGamePersonStore(PackedStoreLayout)
+	read, err := packed.ReadFrom(bytes.NewReader(file.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, written, read)
+	assert.Equal(t, columnar.Len(), packed.Len())
+	for i := 0; i < packed.Len(); i++ {
+		assert.Equal(t, columnar.Get(i), packed.Get(i))
+	}
+
+	corrupted := bytes.Clone(file.Bytes())
+	corrupted[storeHeaderSize+10] ^= 0xFF
+	_, err = packed.ReadFrom(bytes.NewReader(corrupted))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Equal(t, 100, packed.Len()) // the store isn't changed on errors
+
+	corrupted = bytes.Clone(file.Bytes())
+	corrupted[4] = 2
+	_, err = packed.ReadFrom(bytes.NewReader(corrupted))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	_, err = packed.ReadFrom(bytes.NewReader([]byte("NOPE")))
+	assert.ErrorIs(t, err, ErrInvalidStoreFile)
+
+	_, err = packed.ReadFrom(bytes.NewReader(file.Bytes()[:file.Len()-10]))
+	assert.ErrorIs(t, err, ErrInvalidStoreFile)
+
+	trailing := bytes.NewBuffer(bytes.Clone(file.Bytes()))
+	trailing.WriteString("tail")
+	read, err = packed.ReadFrom(trailing)
+	assert.NoError(t, err)
+	assert.Equal(t, written, read)
+	assert.Equal(t, "tail", trailing.String())
+}
+
+var Sink []int
+
+func BenchmarkGamePersonStoreFind(b *testing.B) {
+	random := rand.New(rand.NewSource(42))
+	persons := make([]GamePerson, 1_000_000)
+	for i := range persons {
+		persons[i] = randomPerson(random)
+	}
+
+	query := PersonQuery{
+		Type:      WarriorGamePersonType,
+		GoldAbove: 5000,
+		Box:       BoundingBox{MinX: -500, MinY: -500, MinZ: -500, MaxX: 500, MaxY: 500, MaxZ: 500},
+	}
+
+	for _, layout := range []struct {
+		name   string
+		layout StoreLayout
+	}{
+		{"packed", PackedStoreLayout},
+		{"columnar", ColumnarStoreLayout},
+	} {
+		store := NewGamePersonStore(layout.layout)
+		for _, person := range persons {
+			store.Add(person)
+		}
+
+		b.Run(layout.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Sink = store.Find(query)
+			}
+		})
+	}
+}
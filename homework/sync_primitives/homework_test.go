@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -8,25 +12,406 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+type FairnessPolicy int
+
+const (
+	// WriterPreferring makes new readers wait while any writer is waiting,
+	// so writers can't be starved by a stream of readers
+	WriterPreferring FairnessPolicy = iota
+	// ReaderPreferring lets new readers in while the lock is read-locked,
+	// writers can be starved by a stream of readers
+	ReaderPreferring
+	// PhaseFair grants the lock in the order of arrival, consecutive
+	// readers share one read phase, so nobody can be starved
+	PhaseFair
+)
+
+func (p FairnessPolicy) String() string {
+	switch p {
+	case WriterPreferring:
+		return "writer-preferring"
+	case ReaderPreferring:
+		return "reader-preferring"
+	case PhaseFair:
+		return "phase-fair"
+	default:
+		return fmt.Sprintf("FairnessPolicy(%d)", int(p))
+	}
+}
+
+// waitBuckets are upper bounds of the wait-time histogram buckets,
+// the last bucket counts all longer waits
+var waitBuckets = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+type WaitHistogram [len(waitBuckets) + 1]uint64
+
+func (h *WaitHistogram) add(wait time.Duration) {
+	bucket, _ := slices.BinarySearch(waitBuckets[:], wait)
+	h[bucket]++
+}
+
+type ModeStats struct {
+	Acquisitions   uint64
+	Canceled       uint64
+	TotalWait      time.Duration
+	MaxWait        time.Duration
+	MaxQueueLength int
+	WaitTime       WaitHistogram
+}
+
+func (s *ModeStats) acquired(wait time.Duration) {
+	s.Acquisitions++
+	s.TotalWait += wait
+	s.MaxWait = max(s.MaxWait, wait)
+	s.WaitTime.add(wait)
+}
+
+type RWMutexStats struct {
+	Read  ModeStats
+	Write ModeStats
+}
+
+type waiter struct {
+	write    bool
+	enqueued time.Time
+	wait     time.Duration // set when the lock is granted
+	ready    chan struct{} // closed when the lock is granted
+}
+
+// RWMutex grants the lock according to the fairness policy,
+// the zero value is an unlocked writer-preferring mutex
 type RWMutex struct {
-	// need to implement
+	policy FairnessPolicy
+
+	mutex          sync.Mutex
+	readers        int
+	writer         bool
+	waitingReaders int
+	waitingWriters int
+	waiters        []*waiter
+	stats          RWMutexStats
+}
+
+func NewRWMutex(policy FairnessPolicy) *RWMutex {
+	return &RWMutex{policy: policy}
+}
+
+// Stats returns a snapshot of the contention statistics,
+// acquisitions without waiting are counted with zero wait time
+func (m *RWMutex) Stats() RWMutexStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.stats
+}
+
+func (m *RWMutex) canLock() bool {
+	if m.policy == PhaseFair && len(m.waiters) != 0 {
+		return false
+	}
+	return !m.writer && m.readers == 0
+}
+
+func (m *RWMutex) canRLock() bool {
+	switch m.policy {
+	case ReaderPreferring:
+		return !m.writer
+	case PhaseFair:
+		return !m.writer && len(m.waiters) == 0
+	default:
+		return !m.writer && m.waitingWriters == 0
+	}
+}
+
+// grant must be called with the internal mutex held
+// after any change of the state
+func (m *RWMutex) grant() {
+	switch m.policy {
+	case ReaderPreferring:
+		m.grantReaders()
+		if m.readers == 0 {
+			m.grantWriter()
+		}
+	case PhaseFair:
+		for len(m.waiters) != 0 && !m.writer {
+			if m.waiters[0].write {
+				if m.readers == 0 {
+					m.grantAt(0)
+				}
+				return
+			}
+			m.grantAt(0)
+		}
+	default:
+		if m.waitingWriters != 0 {
+			m.grantWriter()
+			return
+		}
+		m.grantReaders()
+	}
+}
+
+func (m *RWMutex) grantWriter() {
+	if m.writer || m.readers != 0 {
+		return
+	}
+	if index := slices.IndexFunc(m.waiters, func(w *waiter) bool { return w.write }); index >= 0 {
+		m.grantAt(index)
+	}
+}
+
+func (m *RWMutex) grantReaders() {
+	if m.writer || m.waitingReaders == 0 {
+		return
+	}
+	for i := 0; i < len(m.waiters); {
+		if m.waiters[i].write {
+			i++
+			continue
+		}
+		m.grantAt(i)
+	}
+}
+
+func (m *RWMutex) grantAt(index int) {
+	waiter := m.waiters[index]
+	m.remove(index)
+
+	// stats are recorded by the waiter itself,
+	// it may give up the lock if it's already canceled
+	waiter.wait = time.Since(waiter.enqueued)
+	if waiter.write {
+		m.writer = true
+		m.waitingWriters--
+	} else {
+		m.readers++
+		m.waitingReaders--
+	}
+	close(waiter.ready)
+}
+
+func (m *RWMutex) remove(index int) {
+	m.waiters = slices.Delete(m.waiters, index, index+1)
+}
+
+func (m *RWMutex) enqueue(write bool) *waiter {
+	waiter := &waiter{write: write, enqueued: time.Now(), ready: make(chan struct{})}
+	m.waiters = append(m.waiters, waiter)
+	if write {
+		m.waitingWriters++
+		m.stats.Write.MaxQueueLength = max(m.stats.Write.MaxQueueLength, m.waitingWriters)
+	} else {
+		m.waitingReaders++
+		m.stats.Read.MaxQueueLength = max(m.stats.Read.MaxQueueLength, m.waitingReaders)
+	}
+	return waiter
+}
+
+func (m *RWMutex) modeStats(write bool) *ModeStats {
+	if write {
+		return &m.stats.Write
+	}
+	return &m.stats.Read
+}
+
+// acquire returns nil if the lock is acquired, a waiter that gives up
+// is removed from the queue and other waiters are granted if possible
+func (m *RWMutex) acquire(ctx context.Context, write bool) error {
+	if ctx.Done() == nil {
+		// only an acquisition that can't be canceled can deadlock forever
+		lockOrderBefore(m)
+	}
+
+	m.mutex.Lock()
+	if write && m.canLock() {
+		m.writer = true
+		m.stats.Write.acquired(0)
+		m.mutex.Unlock()
+		lockOrderAcquired(m)
+		return nil
+	}
+	if !write && m.canRLock() {
+		m.readers++
+		m.stats.Read.acquired(0)
+		m.mutex.Unlock()
+		lockOrderAcquired(m)
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		m.modeStats(write).Canceled++
+		m.mutex.Unlock()
+		return err
+	}
+
+	waiter := m.enqueue(write)
+	m.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		m.mutex.Lock()
+		m.modeStats(write).acquired(waiter.wait)
+		m.mutex.Unlock()
+		lockOrderAcquired(m)
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		// the lock is granted after the cancellation,
+		// so it's released as if it wasn't acquired
+		if write {
+			m.writer = false
+		} else {
+			m.readers--
+		}
+	default:
+		m.remove(slices.Index(m.waiters, waiter))
+		if write {
+			m.waitingWriters--
+		} else {
+			m.waitingReaders--
+		}
+	}
+
+	m.modeStats(write).Canceled++
+	m.grant()
+	return ctx.Err()
 }
 
 func (m *RWMutex) Lock() {
-	// need to implement
+	_ = m.acquire(context.Background(), true)
+}
+
+// LockContext returns the context error if the context
+// is done before the lock is acquired
+func (m *RWMutex) LockContext(ctx context.Context) error {
+	return m.acquire(ctx, true)
+}
+
+func (m *RWMutex) TryLock() bool {
+	m.mutex.Lock()
+	if !m.canLock() {
+		m.mutex.Unlock()
+		return false
+	}
+	m.writer = true
+	m.stats.Write.acquired(0)
+	m.mutex.Unlock()
+
+	lockOrderAcquired(m)
+	return true
 }
 
 func (m *RWMutex) Unlock() {
-	// need to implement
+	lockOrderReleased(m)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.writer {
+		panic("unlock of unlocked RWMutex")
+	}
+	m.writer = false
+	m.grant()
 }
 
 func (m *RWMutex) RLock() {
-	// need to implement
+	_ = m.acquire(context.Background(), false)
+}
 
+// RLockContext returns the context error if the context
+// is done before the lock is acquired
+func (m *RWMutex) RLockContext(ctx context.Context) error {
+	return m.acquire(ctx, false)
+}
+
+func (m *RWMutex) TryRLock() bool {
+	m.mutex.Lock()
+	if !m.canRLock() {
+		m.mutex.Unlock()
+		return false
+	}
+	m.readers++
+	m.stats.Read.acquired(0)
+	m.mutex.Unlock()
+
+	lockOrderAcquired(m)
+	return true
 }
 
 func (m *RWMutex) RUnlock() {
-	// need to implement
+	lockOrderReleased(m)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.readers == 0 {
+		panic("runlock of unlocked RWMutex")
+	}
+	m.readers--
+	m.grant()
+}
+
+type ViolationKind int
+
+const (
+	LockOrderInversion ViolationKind = iota
+	RecursiveLocking
+)
+
+// LockOrderViolation is reported by the lock-order detector in the
+// lockdebug build, Stack is the stack of the current acquisition and
+// PreviousStack is the stack of the acquisition it conflicts with
+type LockOrderViolation struct {
+	Kind          ViolationKind
+	Lock          *RWMutex
+	Held          *RWMutex
+	Stack         []byte
+	PreviousStack []byte
+}
+
+func (v *LockOrderViolation) Error() string {
+	var description string
+	switch v.Kind {
+	case RecursiveLocking:
+		description = fmt.Sprintf("recursive locking of %p", v.Lock)
+	default:
+		description = fmt.Sprintf("lock order inversion: %p is acquired while holding %p, but the opposite order was seen before", v.Lock, v.Held)
+	}
+	return fmt.Sprintf("%s\n\ncurrent acquisition:\n%s\nprevious acquisition:\n%s", description, v.Stack, v.PreviousStack)
+}
+
+// Mutex is an exclusive lock on top of RWMutex,
+// the zero value is an unlocked mutex
+type Mutex struct {
+	rw RWMutex
+}
+
+func (m *Mutex) Lock() {
+	m.rw.Lock()
+}
+
+func (m *Mutex) LockContext(ctx context.Context) error {
+	return m.rw.LockContext(ctx)
+}
+
+func (m *Mutex) TryLock() bool {
+	return m.rw.TryLock()
+}
+
+func (m *Mutex) Unlock() {
+	m.rw.Unlock()
 }
 
 func TestRWMutexWithWriter(t *testing.T) {
@@ -121,3 +506,347 @@ func TestRWMutexWithWriterPriority(t *testing.T) {
 	assert.True(t, mutualExlusionWithWriter.Load())
 	assert.Equal(t, int32(1), readersCount.Load())
 }
+
+func TestRWMutexTryLock(t *testing.T) {
+	var mutex RWMutex
+	assert.True(t, mutex.TryRLock())
+	assert.True(t, mutex.TryRLock())
+	assert.False(t, mutex.TryLock())
+
+	mutex.RUnlock()
+	mutex.RUnlock()
+	assert.True(t, mutex.TryLock())
+	assert.False(t, mutex.TryLock())
+	assert.False(t, mutex.TryRLock())
+	mutex.Unlock()
+
+	// a waiting writer has a higher priority than new readers
+	mutex.RLock()
+	go mutex.Lock()
+	time.Sleep(time.Millisecond * 100)
+	assert.False(t, mutex.TryRLock())
+
+	mutex.RUnlock()
+	time.Sleep(time.Millisecond * 100)
+	assert.False(t, mutex.TryLock())
+	mutex.Unlock()
+	assert.True(t, mutex.TryRLock())
+}
+
+func TestRWMutexLockContext(t *testing.T) {
+	var mutex RWMutex
+	mutex.RLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	assert.ErrorIs(t, mutex.LockContext(ctx), context.DeadlineExceeded)
+
+	// the canceled writer doesn't block new readers anymore
+	assert.True(t, mutex.TryRLock())
+	mutex.RUnlock()
+	mutex.RUnlock()
+
+	mutex.Lock()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	assert.ErrorIs(t, mutex.RLockContext(ctx), context.DeadlineExceeded)
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	assert.ErrorIs(t, mutex.LockContext(canceled), context.Canceled)
+	mutex.Unlock()
+
+	assert.NoError(t, mutex.LockContext(context.Background()))
+	mutex.Unlock()
+	assert.NoError(t, mutex.RLockContext(context.Background()))
+	mutex.RUnlock()
+	assert.True(t, mutex.TryLock())
+}
+
+func TestRWMutexCanceledWriterReleasesReaders(t *testing.T) {
+	var mutex RWMutex
+	mutex.RLock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_ = mutex.LockContext(ctx)
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	var readersCount atomic.Int32
+	go func() {
+		mutex.RLock() // waits for the writer
+		readersCount.Add(1)
+	}()
+
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(0), readersCount.Load())
+
+	cancel()
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(1), readersCount.Load())
+}
+
+func TestRWMutexStress(t *testing.T) {
+	for _, policy := range []FairnessPolicy{WriterPreferring, ReaderPreferring, PhaseFair} {
+		t.Run(policy.String(), func(t *testing.T) {
+			testRWMutexStress(t, NewRWMutex(policy))
+		})
+	}
+}
+
+func testRWMutexStress(t *testing.T, mutex *RWMutex) {
+	const goroutinesNumber = 32
+	const iterationsNumber = 500
+
+	var readers, writers atomic.Int32
+	var value int
+
+	check := func() {
+		assert.True(t, writers.Load() == 0 || (writers.Load() == 1 && readers.Load() == 0))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(goroutinesNumber)
+	for goroutine := 0; goroutine < goroutinesNumber; goroutine++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterationsNumber; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%5)*time.Microsecond)
+				switch (goroutine + i) % 6 {
+				case 0:
+					mutex.Lock()
+					writers.Add(1)
+					check()
+					value++
+					writers.Add(-1)
+					mutex.Unlock()
+				case 1:
+					if mutex.LockContext(ctx) == nil {
+						writers.Add(1)
+						check()
+						value++
+						writers.Add(-1)
+						mutex.Unlock()
+					}
+				case 2:
+					if mutex.TryLock() {
+						writers.Add(1)
+						check()
+						value++
+						writers.Add(-1)
+						mutex.Unlock()
+					}
+				case 3:
+					mutex.RLock()
+					readers.Add(1)
+					check()
+					_ = value
+					readers.Add(-1)
+					mutex.RUnlock()
+				case 4:
+					if mutex.RLockContext(ctx) == nil {
+						readers.Add(1)
+						check()
+						_ = value
+						readers.Add(-1)
+						mutex.RUnlock()
+					}
+				case 5:
+					if mutex.TryRLock() {
+						readers.Add(1)
+						check()
+						_ = value
+						readers.Add(-1)
+						mutex.RUnlock()
+					}
+				}
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.True(t, mutex.TryLock())
+}
+
+func TestRWMutexPolicies(t *testing.T) {
+	tests := map[FairnessPolicy][]string{
+		WriterPreferring: {"writer", "first reader", "second reader"},
+		ReaderPreferring: {"first reader", "second reader", "writer"},
+		PhaseFair:        {"first reader", "writer", "second reader"},
+	}
+
+	for policy, expectedOrder := range tests {
+		t.Run(policy.String(), func(t *testing.T) {
+			mutex := NewRWMutex(policy)
+			mutex.Lock()
+
+			var orderMutex sync.Mutex
+			var order []string
+			var wg sync.WaitGroup
+
+			wait := func(name string, write bool) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if write {
+						mutex.Lock()
+						defer mutex.Unlock()
+					} else {
+						mutex.RLock()
+						defer mutex.RUnlock()
+					}
+
+					orderMutex.Lock()
+					order = append(order, name)
+					orderMutex.Unlock()
+					time.Sleep(time.Millisecond * 100)
+				}()
+				time.Sleep(time.Millisecond * 50)
+			}
+
+			wait("first reader", false)
+			wait("writer", true)
+			wait("second reader", false)
+
+			mutex.Unlock()
+			wg.Wait()
+
+			// both readers are granted at once and can append in any order
+			switch policy {
+			case ReaderPreferring:
+				slices.Sort(order[:2])
+			case WriterPreferring:
+				slices.Sort(order[1:])
+			}
+			assert.Equal(t, expectedOrder, order)
+		})
+	}
+}
+
+func TestRWMutexReaderPreferringAdmitsNewReaders(t *testing.T) {
+	mutex := NewRWMutex(ReaderPreferring)
+	mutex.RLock()
+
+	var writerAcquired atomic.Bool
+	go func() {
+		mutex.Lock()
+		writerAcquired.Store(true)
+		mutex.Unlock()
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	assert.True(t, mutex.TryRLock())
+	assert.False(t, writerAcquired.Load())
+
+	mutex.RUnlock()
+	mutex.RUnlock()
+	time.Sleep(time.Millisecond * 100)
+	assert.True(t, writerAcquired.Load())
+}
+
+func TestRWMutexStats(t *testing.T) {
+	mutex := NewRWMutex(WriterPreferring)
+	mutex.Lock()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			mutex.RLock()
+			mutex.RUnlock()
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		mutex.Lock()
+		mutex.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond * 100)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.Error(t, mutex.RLockContext(ctx))
+
+	mutex.Unlock()
+	wg.Wait()
+
+	stats := mutex.Stats()
+	assert.Equal(t, uint64(2), stats.Write.Acquisitions)
+	assert.Equal(t, uint64(2), stats.Read.Acquisitions)
+	assert.Equal(t, uint64(1), stats.Read.Canceled)
+	assert.Equal(t, uint64(0), stats.Write.Canceled)
+	assert.Equal(t, 3, stats.Read.MaxQueueLength)
+	assert.Equal(t, 1, stats.Write.MaxQueueLength)
+	assert.GreaterOrEqual(t, stats.Write.MaxWait, time.Millisecond*100)
+
+	var histogramTotal uint64
+	for _, count := range stats.Read.WaitTime {
+		histogramTotal += count
+	}
+	assert.Equal(t, stats.Read.Acquisitions, histogramTotal)
+	assert.Equal(t, uint64(1), stats.Write.WaitTime[0])
+	assert.Equal(t, uint64(1), stats.Write.WaitTime[len(waitBuckets)-1])
+}
+
+func TestRWMutexStatsGrantedAfterCancel(t *testing.T) {
+	mutex := NewRWMutex(WriterPreferring)
+	mutex.Lock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- mutex.LockContext(ctx)
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	// the waiter is granted the lock while it is
+	// handling the cancellation under the internal mutex
+	mutex.mutex.Lock()
+	cancel()
+	time.Sleep(time.Millisecond * 100)
+	mutex.writer = false
+	mutex.grant()
+	mutex.mutex.Unlock()
+
+	assert.ErrorIs(t, <-result, context.Canceled)
+	assert.True(t, mutex.TryLock())
+	mutex.Unlock()
+
+	stats := mutex.Stats()
+	assert.Equal(t, uint64(2), stats.Write.Acquisitions)
+	assert.Equal(t, uint64(1), stats.Write.Canceled)
+	assert.Equal(t, uint64(2), stats.Write.WaitTime[0])
+	assert.Zero(t, stats.Write.TotalWait)
+	assert.Zero(t, stats.Write.MaxWait)
+}
+
+func BenchmarkRWMutexPolicies(b *testing.B) {
+	for _, policy := range []FairnessPolicy{WriterPreferring, ReaderPreferring, PhaseFair} {
+		b.Run(policy.String(), func(b *testing.B) {
+			mutex := NewRWMutex(policy)
+			var counter int
+
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if i%10 == 0 {
+						mutex.Lock()
+						counter++
+						mutex.Unlock()
+					} else {
+						mutex.RLock()
+						_ = counter
+						mutex.RUnlock()
+					}
+				}
+			})
+
+			stats := mutex.Stats()
+			b.ReportMetric(float64(stats.Write.MaxWait.Microseconds()), "max-write-wait-us")
+			b.ReportMetric(float64(stats.Read.MaxWait.Microseconds()), "max-read-wait-us")
+		})
+	}
+}
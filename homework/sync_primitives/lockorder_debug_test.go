@@ -0,0 +1,363 @@
+//go:build lockdebug
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type heldLock struct {
+	lock  *RWMutex
+	stack []byte
+}
+
+// lockOrder is a global graph of the lock acquisition order, an edge
+// from one lock to another keeps the stack of the first acquisition
+// of the second lock while holding the first one
+var lockOrder = struct {
+	mutex   sync.Mutex
+	graph   map[*RWMutex]map[*RWMutex][]byte
+	held    map[uint64][]heldLock
+	handler func(*LockOrderViolation)
+}{
+	graph: make(map[*RWMutex]map[*RWMutex][]byte),
+	held:  make(map[uint64][]heldLock),
+}
+
+// SetLockOrderHandler sets the handler of the detected violations,
+// violations panic if the handler is nil
+func SetLockOrderHandler(handler func(*LockOrderViolation)) {
+	lockOrder.mutex.Lock()
+	defer lockOrder.mutex.Unlock()
+	lockOrder.handler = handler
+}
+
+func goroutineID() uint64 {
+	var buffer [64]byte
+	stack := buffer[:runtime.Stack(buffer[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	stack = stack[:bytes.IndexByte(stack, ' ')]
+
+	id, err := strconv.ParseUint(string(stack), 10, 64)
+	if err != nil {
+		panic("can't parse goroutine id: " + err.Error())
+	}
+	return id
+}
+
+// lockOrderBefore checks and records the order before a blocking
+// acquisition, so a potential deadlock is reported instead of hanging
+func lockOrderBefore(m *RWMutex) {
+	stack := debug.Stack()
+
+	id := goroutineID()
+
+	lockOrder.mutex.Lock()
+	violation := findViolation(m, lockOrder.held[id], stack)
+	for _, held := range lockOrder.held[id] {
+		if held.lock == m {
+			continue
+		}
+		edges, found := lockOrder.graph[held.lock]
+		if !found {
+			edges = make(map[*RWMutex][]byte)
+			lockOrder.graph[held.lock] = edges
+		}
+		if _, found := edges[m]; !found {
+			edges[m] = stack
+		}
+	}
+	handler := lockOrder.handler
+	lockOrder.mutex.Unlock()
+
+	if violation == nil {
+		return
+	}
+	if handler == nil {
+		panic(violation)
+	}
+	handler(violation)
+}
+
+func findViolation(m *RWMutex, held []heldLock, stack []byte) *LockOrderViolation {
+	for _, lock := range held {
+		if lock.lock == m {
+			return &LockOrderViolation{
+				Kind:          RecursiveLocking,
+				Lock:          m,
+				Held:          m,
+				Stack:         stack,
+				PreviousStack: lock.stack,
+			}
+		}
+	}
+
+	for _, lock := range held {
+		if previousStack := findPath(m, lock.lock, make(map[*RWMutex]bool)); previousStack != nil {
+			return &LockOrderViolation{
+				Kind:          LockOrderInversion,
+				Lock:          m,
+				Held:          lock.lock,
+				Stack:         stack,
+				PreviousStack: previousStack,
+			}
+		}
+	}
+	return nil
+}
+
+// findPath returns the stack of the first edge of a path between locks
+func findPath(from, to *RWMutex, visited map[*RWMutex]bool) []byte {
+	visited[from] = true
+	for next, stack := range lockOrder.graph[from] {
+		if next == to {
+			return stack
+		}
+		if !visited[next] && findPath(next, to, visited) != nil {
+			return stack
+		}
+	}
+	return nil
+}
+
+func lockOrderAcquired(m *RWMutex) {
+	stack := debug.Stack()
+
+	lockOrder.mutex.Lock()
+	defer lockOrder.mutex.Unlock()
+
+	id := goroutineID()
+	lockOrder.held[id] = append(lockOrder.held[id], heldLock{lock: m, stack: stack})
+}
+
+// lockOrderReleased forgets the lock held by the current goroutine,
+// or by any goroutine because a lock can be released by another one
+func lockOrderReleased(m *RWMutex) {
+	lockOrder.mutex.Lock()
+	defer lockOrder.mutex.Unlock()
+
+	id := goroutineID()
+	if forget(id, m) {
+		return
+	}
+	for id := range lockOrder.held {
+		if forget(id, m) {
+			return
+		}
+	}
+}
+
+func forget(id uint64, m *RWMutex) bool {
+	held := lockOrder.held[id]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i].lock == m {
+			held = slices.Delete(held, i, i+1)
+			if len(held) == 0 {
+				delete(lockOrder.held, id)
+			} else {
+				lockOrder.held[id] = held
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// ForgetLock removes the lock from the order graph, it should be called
+// before a lock is discarded because the graph keeps every lock it has
+// seen, otherwise locks created in a loop grow the graph without a bound
+func ForgetLock(m *RWMutex) {
+	lockOrder.mutex.Lock()
+	defer lockOrder.mutex.Unlock()
+
+	delete(lockOrder.graph, m)
+	for lock, edges := range lockOrder.graph {
+		delete(edges, m)
+		if len(edges) == 0 {
+			delete(lockOrder.graph, lock)
+		}
+	}
+	for id := range lockOrder.held {
+		for forget(id, m) {
+		}
+	}
+}
+
+func collectViolations(t *testing.T) *[]*LockOrderViolation {
+	var violations []*LockOrderViolation
+	SetLockOrderHandler(func(violation *LockOrderViolation) {
+		violations = append(violations, violation)
+	})
+	t.Cleanup(func() {
+		SetLockOrderHandler(nil)
+	})
+	return &violations
+}
+
+type Cache struct {
+	mutex RWMutex
+	data  map[string]string
+}
+
+func (c *Cache) Get(key string) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.Size() > 0 {
+		return c.data[key]
+	}
+	return ""
+}
+
+func (c *Cache) Size() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.data)
+}
+
+func TestLockOrderRecursiveLocking(t *testing.T) {
+	violations := collectViolations(t)
+
+	cache := Cache{data: map[string]string{"key": "value"}}
+	assert.Equal(t, "value", cache.Get("key"))
+
+	assert.Len(t, *violations, 1)
+	violation := (*violations)[0]
+	assert.Equal(t, RecursiveLocking, violation.Kind)
+	assert.Same(t, &cache.mutex, violation.Lock)
+	assert.Contains(t, string(violation.Stack), "(*Cache).Size")
+	assert.Contains(t, string(violation.PreviousStack), "(*Cache).Get")
+}
+
+func TestLockOrderRecursiveLockingPanics(t *testing.T) {
+	var mutex Mutex
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	defer func() {
+		violation, ok := recover().(*LockOrderViolation)
+		assert.True(t, ok)
+		assert.Equal(t, RecursiveLocking, violation.Kind)
+	}()
+	mutex.Lock() // panics instead of the deadlock
+}
+
+func TestLockOrderInversion(t *testing.T) {
+	violations := collectViolations(t)
+
+	var first, second Mutex
+	lockBoth := func(lhs, rhs *Mutex) {
+		lhs.Lock()
+		rhs.Lock()
+		rhs.Unlock()
+		lhs.Unlock()
+	}
+
+	// no deadlock happens, but it's possible with two goroutines
+	lockBoth(&first, &second)
+	lockBoth(&first, &second)
+	assert.Empty(t, *violations)
+
+	lockBoth(&second, &first)
+	assert.Len(t, *violations, 1)
+
+	violation := (*violations)[0]
+	assert.Equal(t, LockOrderInversion, violation.Kind)
+	assert.Same(t, &first.rw, violation.Lock)
+	assert.Same(t, &second.rw, violation.Held)
+	assert.NotEmpty(t, violation.Stack)
+	assert.NotEmpty(t, violation.PreviousStack)
+	assert.NotEqual(t, violation.Stack, violation.PreviousStack)
+}
+
+func TestLockOrderInversionThroughChain(t *testing.T) {
+	violations := collectViolations(t)
+
+	var first, second, third RWMutex
+	first.Lock()
+	second.RLock()
+	second.RUnlock()
+	first.Unlock()
+
+	second.Lock()
+	third.Lock()
+	third.Unlock()
+	second.Unlock()
+	assert.Empty(t, *violations)
+
+	third.RLock()
+	first.RLock()
+	first.RUnlock()
+	third.RUnlock()
+
+	assert.Len(t, *violations, 1)
+	assert.Same(t, &first, (*violations)[0].Lock)
+	assert.Same(t, &third, (*violations)[0].Held)
+}
+
+func TestLockOrderForgetLock(t *testing.T) {
+	violations := collectViolations(t)
+
+	var first RWMutex
+	for i := 0; i < 100; i++ {
+		var second RWMutex
+		first.Lock()
+		second.Lock()
+		second.Unlock()
+		first.Unlock()
+		ForgetLock(&second)
+	}
+
+	lockOrder.mutex.Lock()
+	_, found := lockOrder.graph[&first]
+	lockOrder.mutex.Unlock()
+	assert.False(t, found)
+
+	var second RWMutex
+	first.Lock()
+	second.Lock()
+	second.Unlock()
+	first.Unlock()
+	ForgetLock(&first)
+
+	// the order is forgotten with the lock
+	second.Lock()
+	first.Lock()
+	first.Unlock()
+	second.Unlock()
+	assert.Empty(t, *violations)
+}
+
+func TestLockOrderIgnoresCancelableAndTryLocks(t *testing.T) {
+	violations := collectViolations(t)
+
+	var mutex RWMutex
+	mutex.Lock()
+	assert.False(t, mutex.TryRLock())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.Error(t, mutex.LockContext(ctx))
+
+	// the lock is released by another goroutine
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mutex.Unlock()
+	}()
+	<-done
+
+	mutex.Lock()
+	mutex.Unlock()
+	assert.Empty(t, *violations)
+}
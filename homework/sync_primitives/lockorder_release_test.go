@@ -0,0 +1,13 @@
+//go:build !lockdebug
+
+package main
+
+// the lock-order detector is enabled with the lockdebug build tag,
+// otherwise the hooks are empty and inlined by the compiler
+
+func SetLockOrderHandler(func(*LockOrderViolation)) {}
+func ForgetLock(*RWMutex)                           {}
+
+func lockOrderBefore(*RWMutex)   {}
+func lockOrderAcquired(*RWMutex) {}
+func lockOrderReleased(*RWMutex) {}